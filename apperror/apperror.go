@@ -0,0 +1,58 @@
+// Package apperror defines the domain errors shared by repositories, services
+// and the HTTP layer. Every domain error belongs to one of the kinds below, so
+// callers can test for a whole class of failures with errors.Is.
+package apperror
+
+import "errors"
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+	ErrOutOfStock = errors.New("out of stock")
+)
+
+// FieldError describes why a single input field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error of a given Kind. Code is a stable machine readable
+// identifier, Message is meant for humans. Err optionally keeps the more
+// specific error that caused it.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+
+	return []error{e.Kind, e.Err}
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+func Validation(code, message string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message, Fields: fields}
+}
+
+func OutOfStock(code, message string) *Error {
+	return &Error{Kind: ErrOutOfStock, Code: code, Message: message}
+}
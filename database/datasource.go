@@ -28,7 +28,7 @@ func NewDatabase() (*Database, error) {
 
 	db, err := sqlx.Open("postgres", connect)
 	if err != nil {
-		return nil, fmt.Errorf("error opening database: %v", err)
+		return nil, fmt.Errorf("error opening database: %w", err)
 	}
 
 	return &Database{db: db}, nil
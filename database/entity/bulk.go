@@ -0,0 +1,30 @@
+package entity
+
+type BulkStatus string
+
+const (
+	BulkStatusCreated BulkStatus = "created"
+	BulkStatusUpdated BulkStatus = "updated"
+	BulkStatusDeleted BulkStatus = "deleted"
+	BulkStatusFailed  BulkStatus = "failed"
+	// BulkStatusSkipped marks valid items that were not written because an
+	// atomic request failed as a whole.
+	BulkStatusSkipped BulkStatus = "skipped"
+)
+
+// BulkItemRes reports the outcome of one item of a bulk request. Index is the
+// position of the item in the request.
+type BulkItemRes struct {
+	Index   int         `json:"index"`
+	ID      int64       `json:"id,omitempty"`
+	Status  BulkStatus  `json:"status"`
+	Product *ProductRes `json:"product,omitempty"`
+	Error   *ErrorBody  `json:"error,omitempty"`
+}
+
+type BulkRes struct {
+	Atomic    bool          `json:"atomic"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BulkItemRes `json:"results"`
+}
@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// Category is a node of the category tree. Path is the materialized path of
+// slugs from the root, e.g. "electronics/audio/headphones".
+type Category struct {
+	ID        int64     `json:"id" db:"id"`
+	ParentID  *int64    `json:"parent_id" db:"parent_id"`
+	Name      string    `json:"name" db:"name"`
+	Slug      string    `json:"slug" db:"slug"`
+	Path      string    `json:"path" db:"path"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CategoryReq creates or replaces a category. An empty slug is derived from
+// the name.
+type CategoryReq struct {
+	ParentID *int64 `json:"parent_id"`
+	Name     string `json:"name" validate:"required,max=255"`
+	Slug     string `json:"slug" validate:"max=255,slug"`
+}
+
+type CategoryRes struct {
+	ID        int64     `json:"id"`
+	ParentID  *int64    `json:"parent_id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CategoryTreeRes struct {
+	CategoryRes
+	Children []CategoryTreeRes `json:"children"`
+}
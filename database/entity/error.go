@@ -0,0 +1,15 @@
+package entity
+
+import "chi-sqlx/apperror"
+
+// ErrorRes is the body of every error response.
+type ErrorRes struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code      string                `json:"code"`
+	Message   string                `json:"message"`
+	Fields    []apperror.FieldError `json:"fields,omitempty"`
+	RequestID string                `json:"request_id,omitempty"`
+}
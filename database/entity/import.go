@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"chi-sqlx/apperror"
+	"time"
+)
+
+type ImportFormat string
+
+const (
+	ImportFormatCSV    ImportFormat = "csv"
+	ImportFormatNDJSON ImportFormat = "ndjson"
+)
+
+type ImportAction string
+
+const (
+	ImportActionCreate ImportAction = "create"
+	ImportActionUpdate ImportAction = "update"
+	ImportActionError  ImportAction = "error"
+)
+
+// ImportLine reports what happened, or in a dry run would happen, to a single
+// line of an import. Line numbers start at 1 and count the CSV header.
+type ImportLine struct {
+	Line    int                   `json:"line"`
+	Action  ImportAction          `json:"action"`
+	ID      int64                 `json:"id,omitempty"`
+	Name    string                `json:"name,omitempty"`
+	Message string                `json:"message,omitempty"`
+	Fields  []apperror.FieldError `json:"fields,omitempty"`
+}
+
+// ImportReport sums up an import. Results holds the first lines only, see
+// Truncated.
+type ImportReport struct {
+	DryRun    bool         `json:"dry_run"`
+	Lines     int          `json:"lines"`
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Failed    int          `json:"failed"`
+	Results   []ImportLine `json:"results"`
+	Truncated bool         `json:"truncated,omitempty"`
+}
+
+type ImportStatus string
+
+const (
+	ImportStatusRunning ImportStatus = "running"
+	ImportStatusDone    ImportStatus = "done"
+	ImportStatusFailed  ImportStatus = "failed"
+)
+
+// ImportJob tracks an import running in the background. Report is updated
+// after every batch, so it doubles as the progress of the import.
+type ImportJob struct {
+	ID         string       `json:"id"`
+	Status     ImportStatus `json:"status"`
+	Format     ImportFormat `json:"format"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at"`
+	Error      string       `json:"error,omitempty"`
+	Report     ImportReport `json:"report"`
+}
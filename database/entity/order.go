@@ -3,13 +3,39 @@ package entity
 import "time"
 
 type Order struct {
-	ID            int64      `json:"id" db:"id"`
-	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
-	DeletedAt     *time.Time `json:"deleted_at" db:"deleted_at"`
-	PaymentMethod string     `json:"payment_method" db:"payment_method"`
-	TaxPrice      float64    `json:"tax_price" db:"tax_price"`
-	ShippingPrice float64    `json:"shipping_price" db:"shipping_price"`
-	TotalPrice    float64    `json:"total_price" db:"total_price"`
-	Items         []OrderItem
+	ID            int64       `json:"id" db:"id"`
+	Version       int64       `json:"version" db:"version"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at" db:"updated_at"`
+	DeletedAt     *time.Time  `json:"deleted_at" db:"deleted_at"`
+	Status        OrderStatus `json:"status" db:"status"`
+	PaymentMethod string      `json:"payment_method" db:"payment_method"`
+	TaxPrice      float64     `json:"tax_price" db:"tax_price"`
+	ShippingPrice float64     `json:"shipping_price" db:"shipping_price"`
+	TotalPrice    float64     `json:"total_price" db:"total_price"`
+	Items         []OrderItem `json:"items" db:"-"`
+}
+
+type OrderReq struct {
+	PaymentMethod string         `json:"payment_method" validate:"required,max=255"`
+	ShippingPrice float64        `json:"shipping_price" validate:"min=0,max=99999999.99"`
+	Items         []OrderItemReq `json:"items" validate:"required,max=100"`
+}
+
+type OrderRes struct {
+	ID            int64          `json:"id"`
+	Version       int64          `json:"version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     *time.Time     `json:"deleted_at"`
+	Status        OrderStatus    `json:"status"`
+	PaymentMethod string         `json:"payment_method"`
+	TaxPrice      float64        `json:"tax_price"`
+	ShippingPrice float64        `json:"shipping_price"`
+	TotalPrice    float64        `json:"total_price"`
+	Items         []OrderItemRes `json:"items"`
+}
+
+type OrderFilter struct {
+	IncludeDeleted bool
 }
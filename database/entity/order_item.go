@@ -12,5 +12,27 @@ type OrderItem struct {
 	Image     string     `json:"image" db:"image"`
 	Price     float64    `json:"price" db:"price"`
 	ProductID int64      `json:"product_id" db:"product_id"`
+	VariantID *int64     `json:"variant_id" db:"variant_id"`
 	OrderID   int64      `json:"order_id" db:"order_id"`
 }
+
+// OrderItemReq orders a product, or with VariantID one of its variants.
+type OrderItemReq struct {
+	Quantity  int64  `json:"quantity" validate:"min=1"`
+	ProductID int64  `json:"product_id" validate:"required"`
+	VariantID *int64 `json:"variant_id"`
+}
+
+type OrderItemRes struct {
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	Name      string     `json:"name"`
+	Quantity  int64      `json:"quantity"`
+	Image     string     `json:"image"`
+	Price     float64    `json:"price"`
+	ProductID int64      `json:"product_id"`
+	VariantID *int64     `json:"variant_id"`
+	OrderID   int64      `json:"order_id"`
+}
@@ -0,0 +1,49 @@
+package entity
+
+import "time"
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+)
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled:
+		return true
+	}
+
+	return false
+}
+
+type OrderStatusHistory struct {
+	ID         int64       `json:"id" db:"id"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+	OrderID    int64       `json:"order_id" db:"order_id"`
+	FromStatus OrderStatus `json:"from_status" db:"from_status"`
+	ToStatus   OrderStatus `json:"to_status" db:"to_status"`
+	Reason     string      `json:"reason" db:"reason"`
+}
+
+type OrderTransitionReq struct {
+	Status OrderStatus `json:"status" validate:"required,oneof=pending paid shipped delivered cancelled"`
+	Reason string      `json:"reason" validate:"max=1000"`
+}
+
+type OrderCancelReq struct {
+	Reason string `json:"reason" validate:"max=1000"`
+}
+
+type OrderStatusHistoryRes struct {
+	ID         int64       `json:"id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	OrderID    int64       `json:"order_id"`
+	FromStatus OrderStatus `json:"from_status"`
+	ToStatus   OrderStatus `json:"to_status"`
+	Reason     string      `json:"reason"`
+}
@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Pagination selects one page of a listing. When Cursor is set it takes
+// precedence over Offset.
+type Pagination struct {
+	Limit     int
+	Offset    int
+	Cursor    *Cursor
+	WithTotal bool
+}
+
+// Cursor points at the last row of a page in (created_at, id) order.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"i"`
+}
+
+// Encode returns the opaque string form of the cursor handed out to clients.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// SortField orders a listing by a single field, e.g. "-created_at" is
+// SortField{Field: "created_at", Desc: true}.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+type Page[T any] struct {
+	Items      []T
+	NextCursor *Cursor
+	Total      *int64
+}
+
+type ListRes[T any] struct {
+	Data       []T     `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+	Total      *int64  `json:"total,omitempty"`
+}
@@ -3,42 +3,86 @@ package entity
 import "time"
 
 type Product struct {
-	ID           int64      `json:"id" db:"id"`
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
-	DeletedAt    *time.Time `json:"deleted_at" db:"deleted_at"`
-	Name         string     `json:"name" db:"name"`
-	Image        string     `json:"image" db:"image"`
-	Category     string     `json:"category" db:"category"`
-	Description  string     `json:"description" db:"description"`
-	Rating       int64      `json:"rating" db:"rating"`
-	NumReviews   int64      `json:"num_reviews" db:"num_reviews"`
-	Price        float64    `json:"price" db:"price"`
-	CountInStock int64      `json:"count_in_stock" db:"count_in_stock"`
+	ID               int64      `json:"id" db:"id"`
+	Version          int64      `json:"version" db:"version"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt        *time.Time `json:"deleted_at" db:"deleted_at"`
+	Name             string     `json:"name" db:"name"`
+	Image            string     `json:"image" db:"image"`
+	Category         string     `json:"category" db:"category"`
+	CategoryID       int64      `json:"category_id" db:"category_id"`
+	Description      string     `json:"description" db:"description"`
+	Rating           int64      `json:"rating" db:"rating"`
+	NumReviews       int64      `json:"num_reviews" db:"num_reviews"`
+	Price            float64    `json:"price" db:"price"`
+	CountInStock     int64      `json:"count_in_stock" db:"count_in_stock"`
+	ReorderThreshold int64      `json:"reorder_threshold" db:"reorder_threshold"`
 }
 
+// ProductReq is validated against its validate tags, see package validation.
+// Prices are bounded by the decimal(10,2) column. The category name is taken
+// from the category, rating and num_reviews from the reviews of the product,
+// they cannot be set directly. CountInStock is the initial stock of a new
+// product, updates ignore it since the stock only changes through the stock
+// ledger. A stock below ReorderThreshold raises a low-stock alert, 0 disables
+// the alert.
 type ProductReq struct {
-	Name         string  `json:"name"`
-	Image        string  `json:"image"`
-	Category     string  `json:"category"`
-	Description  string  `json:"description"`
-	Rating       int64   `json:"rating"`
-	NumReviews   int64   `json:"num_reviews"`
-	Price        float64 `json:"price"`
-	CountInStock int64   `json:"count_in_stock"`
+	Name             string  `json:"name" validate:"required,max=255"`
+	Image            string  `json:"image" validate:"max=2048"`
+	CategoryID       int64   `json:"category_id" validate:"required"`
+	Description      string  `json:"description" validate:"max=5000"`
+	Price            float64 `json:"price" validate:"min=0,max=99999999.99"`
+	CountInStock     int64   `json:"count_in_stock" validate:"min=0"`
+	ReorderThreshold int64   `json:"reorder_threshold" validate:"min=0"`
 }
 
 type ProductRes struct {
-	ID           int64      `json:"id"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	DeletedAt    *time.Time `json:"deleted_at"`
-	Name         string     `json:"name"`
-	Image        string     `json:"image"`
-	Category     string     `json:"category"`
-	Description  string     `json:"description"`
-	Rating       int64      `json:"rating"`
-	NumReviews   int64      `json:"num_reviews"`
-	Price        float64    `json:"price"`
-	CountInStock int64      `json:"count_in_stock"`
+	ID               int64      `json:"id"`
+	Version          int64      `json:"version"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeletedAt        *time.Time `json:"deleted_at"`
+	Name             string     `json:"name"`
+	Image            string     `json:"image"`
+	Category         string     `json:"category"`
+	CategoryID       int64      `json:"category_id"`
+	Description      string     `json:"description"`
+	Rating           int64      `json:"rating"`
+	NumReviews       int64      `json:"num_reviews"`
+	Price            float64    `json:"price"`
+	CountInStock     int64      `json:"count_in_stock"`
+	ReorderThreshold int64      `json:"reorder_threshold"`
+}
+
+// ProductFilter narrows down a product listing. Nil and zero fields are not applied.
+// Category matches categories by name or slug. IncludeDescendants extends
+// CategoryID and Category to the whole subtree of the category.
+type ProductFilter struct {
+	CategoryID         *int64
+	Category           string
+	IncludeDescendants bool
+	MinPrice           *float64
+	MaxPrice           *float64
+	MinRating          *int64
+	InStock            bool
+	CreatedAfter       *time.Time
+	CreatedBefore      *time.Time
+	IncludeDeleted     bool
+	Sort               []SortField
+}
+
+// ProductSearchResult is a product found by a search. Headline is HTML: the
+// matching text of name and description, escaped, with the matches wrapped in
+// <mark> tags.
+type ProductSearchResult struct {
+	Product
+	Rank     float64 `json:"rank" db:"rank"`
+	Headline string  `json:"headline" db:"headline"`
+}
+
+type ProductSearchRes struct {
+	ProductRes
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
 }
@@ -0,0 +1,31 @@
+package entity
+
+import "time"
+
+// ProductPrice is the price of a product from EffectiveFrom until EffectiveTo,
+// or from then on when EffectiveTo is nil. A price that is not effective yet
+// is a scheduled price change.
+type ProductPrice struct {
+	ID            int64      `json:"id" db:"id"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	ProductID     int64      `json:"product_id" db:"product_id"`
+	Price         float64    `json:"price" db:"price"`
+	EffectiveFrom time.Time  `json:"effective_from" db:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to" db:"effective_to"`
+}
+
+// ProductPriceReq changes the price of a product at EffectiveFrom, which must
+// not be in the past. Without it the price changes right away.
+type ProductPriceReq struct {
+	Price         float64    `json:"price" validate:"min=0,max=99999999.99"`
+	EffectiveFrom *time.Time `json:"effective_from"`
+}
+
+type ProductPriceRes struct {
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ProductID     int64      `json:"product_id"`
+	Price         float64    `json:"price"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+}
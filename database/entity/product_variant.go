@@ -0,0 +1,91 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VariantOptions are the option values that set a variant apart from the other
+// variants of its product, e.g. {"size": "M", "color": "red"}. They are stored
+// as a jsonb object.
+type VariantOptions map[string]string
+
+func (o VariantOptions) Value() (driver.Value, error) {
+	if o == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(o)
+}
+
+func (o *VariantOptions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	case nil:
+		*o = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into VariantOptions", src)
+	}
+}
+
+// String lists the option values ordered by option name, e.g. "red, M".
+func (o VariantOptions) String() string {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, o[name])
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// ProductVariant is a purchasable version of a product with its own SKU and
+// stock. Price overrides the product price unless it is nil.
+type ProductVariant struct {
+	ID           int64          `json:"id" db:"id"`
+	Version      int64          `json:"version" db:"version"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at" db:"updated_at"`
+	DeletedAt    *time.Time     `json:"deleted_at" db:"deleted_at"`
+	ProductID    int64          `json:"product_id" db:"product_id"`
+	SKU          string         `json:"sku" db:"sku"`
+	Options      VariantOptions `json:"options" db:"options"`
+	Price        *float64       `json:"price" db:"price"`
+	CountInStock int64          `json:"count_in_stock" db:"count_in_stock"`
+}
+
+// ProductVariantReq sets the initial stock of a new variant. Like for products,
+// updates ignore CountInStock since the stock only changes through the stock
+// ledger.
+type ProductVariantReq struct {
+	SKU          string         `json:"sku" validate:"required,max=64"`
+	Options      VariantOptions `json:"options" validate:"max=20"`
+	Price        *float64       `json:"price" validate:"min=0,max=99999999.99"`
+	CountInStock int64          `json:"count_in_stock" validate:"min=0"`
+}
+
+type ProductVariantRes struct {
+	ID           int64          `json:"id"`
+	Version      int64          `json:"version"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    *time.Time     `json:"deleted_at"`
+	ProductID    int64          `json:"product_id"`
+	SKU          string         `json:"sku"`
+	Options      VariantOptions `json:"options"`
+	Price        *float64       `json:"price"`
+	CountInStock int64          `json:"count_in_stock"`
+}
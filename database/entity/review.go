@@ -0,0 +1,63 @@
+package entity
+
+import "time"
+
+// ReviewStatus is the moderation state of a review. Only published reviews
+// are listed by default and count towards the rating of their product.
+type ReviewStatus string
+
+const (
+	ReviewStatusPublished ReviewStatus = "published"
+	ReviewStatusRejected  ReviewStatus = "rejected"
+)
+
+func (s ReviewStatus) Valid() bool {
+	switch s {
+	case ReviewStatusPublished, ReviewStatusRejected:
+		return true
+	}
+
+	return false
+}
+
+type Review struct {
+	ID        int64        `json:"id" db:"id"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
+	DeletedAt *time.Time   `json:"deleted_at" db:"deleted_at"`
+	ProductID int64        `json:"product_id" db:"product_id"`
+	Author    string       `json:"author" db:"author"`
+	Stars     int64        `json:"stars" db:"stars"`
+	Title     string       `json:"title" db:"title"`
+	Body      string       `json:"body" db:"body"`
+	Status    ReviewStatus `json:"status" db:"status"`
+}
+
+type ReviewReq struct {
+	Author string `json:"author" validate:"required,max=100"`
+	Stars  int64  `json:"stars" validate:"min=1,max=5"`
+	Title  string `json:"title" validate:"max=200"`
+	Body   string `json:"body" validate:"max=5000"`
+}
+
+type ReviewModerationReq struct {
+	Status ReviewStatus `json:"status" validate:"required,oneof=published rejected"`
+}
+
+type ReviewRes struct {
+	ID        int64        `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	DeletedAt *time.Time   `json:"deleted_at"`
+	ProductID int64        `json:"product_id"`
+	Author    string       `json:"author"`
+	Stars     int64        `json:"stars"`
+	Title     string       `json:"title"`
+	Body      string       `json:"body"`
+	Status    ReviewStatus `json:"status"`
+}
+
+// ReviewFilter narrows down the reviews of a product to one status.
+type ReviewFilter struct {
+	Status ReviewStatus
+}
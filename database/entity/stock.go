@@ -0,0 +1,59 @@
+package entity
+
+import "time"
+
+// StockReason tells why the stock of a product changed.
+type StockReason string
+
+const (
+	StockReasonSale       StockReason = "sale"
+	StockReasonRestock    StockReason = "restock"
+	StockReasonAdjustment StockReason = "adjustment"
+	StockReasonReturn     StockReason = "return"
+)
+
+// StockMovement is one entry of the append-only stock ledger. The stock of a
+// product, or of one of its variants when VariantID is set, at any time is
+// the sum of the deltas of its movements up to that time. OrderID references
+// the order behind a sale or return, Actor the user behind a manual change.
+type StockMovement struct {
+	ID        int64       `json:"id" db:"id"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
+	ProductID int64       `json:"product_id" db:"product_id"`
+	VariantID *int64      `json:"variant_id" db:"variant_id"`
+	Delta     int64       `json:"delta" db:"delta"`
+	Reason    StockReason `json:"reason" db:"reason"`
+	OrderID   *int64      `json:"order_id" db:"order_id"`
+	Actor     string      `json:"actor" db:"actor"`
+}
+
+// StockChangeReq changes the stock by Delta. Sales are only recorded by orders.
+type StockChangeReq struct {
+	VariantID *int64      `json:"variant_id"`
+	Delta     int64       `json:"delta" validate:"required"`
+	Reason    StockReason `json:"reason" validate:"required,oneof=restock adjustment return"`
+	Actor     string      `json:"actor" validate:"max=100"`
+}
+
+type StockMovementRes struct {
+	ID        int64       `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	ProductID int64       `json:"product_id"`
+	VariantID *int64      `json:"variant_id"`
+	Delta     int64       `json:"delta"`
+	Reason    StockReason `json:"reason"`
+	OrderID   *int64      `json:"order_id"`
+	Actor     string      `json:"actor"`
+}
+
+type StockChangeRes struct {
+	Movement     StockMovementRes `json:"movement"`
+	CountInStock int64            `json:"count_in_stock"`
+}
+
+type StockLevelRes struct {
+	ProductID    int64     `json:"product_id"`
+	VariantID    *int64    `json:"variant_id"`
+	At           time.Time `json:"at"`
+	CountInStock int64     `json:"count_in_stock"`
+}
@@ -0,0 +1,52 @@
+package entity
+
+import "time"
+
+// StockAlertStatus tells whether the stock of the product of an alert is still
+// below its reorder threshold.
+type StockAlertStatus string
+
+const (
+	StockAlertStatusOpen     StockAlertStatus = "open"
+	StockAlertStatusResolved StockAlertStatus = "resolved"
+)
+
+func (s StockAlertStatus) Valid() bool {
+	switch s {
+	case StockAlertStatusOpen, StockAlertStatusResolved:
+		return true
+	}
+
+	return false
+}
+
+// StockAlert is raised when the stock of a product falls below its reorder
+// threshold. CountInStock and ReorderThreshold are the values at that time.
+// The alert is resolved once the stock is back at the threshold.
+type StockAlert struct {
+	ID               int64      `json:"id" db:"id"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	ProductID        int64      `json:"product_id" db:"product_id"`
+	CountInStock     int64      `json:"count_in_stock" db:"count_in_stock"`
+	ReorderThreshold int64      `json:"reorder_threshold" db:"reorder_threshold"`
+	NotifiedAt       *time.Time `json:"notified_at" db:"notified_at"`
+	ResolvedAt       *time.Time `json:"resolved_at" db:"resolved_at"`
+}
+
+type StockAlertRes struct {
+	ID               int64            `json:"id"`
+	CreatedAt        time.Time        `json:"created_at"`
+	ProductID        int64            `json:"product_id"`
+	CountInStock     int64            `json:"count_in_stock"`
+	ReorderThreshold int64            `json:"reorder_threshold"`
+	Status           StockAlertStatus `json:"status"`
+	NotifiedAt       *time.Time       `json:"notified_at"`
+	ResolvedAt       *time.Time       `json:"resolved_at"`
+}
+
+// StockAlertFilter narrows down a listing of alerts. An empty Status lists
+// open and resolved alerts, a nil ProductID the alerts of all products.
+type StockAlertFilter struct {
+	Status    StockAlertStatus
+	ProductID *int64
+}
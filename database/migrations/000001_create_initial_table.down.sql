@@ -1,3 +1,3 @@
 DROP TABLE IF EXISTS order_item;
-DROP TABLE IF EXISTS order;
+DROP TABLE IF EXISTS "order";
 DROP TABLE IF EXISTS product;
@@ -0,0 +1,14 @@
+ALTER TABLE "order" ADD COLUMN "status" varchar NOT NULL DEFAULT 'pending';
+
+CREATE TABLE "order_status_history" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY NOT NULL,
+  "order_id" int NOT NULL,
+  "from_status" varchar NOT NULL,
+  "to_status" varchar NOT NULL,
+  "reason" text NOT NULL DEFAULT '',
+  "created_at" timestamp DEFAULT now()
+);
+
+ALTER TABLE "order_status_history" ADD FOREIGN KEY ("order_id") REFERENCES "order" ("id");
+
+CREATE INDEX ON "order_status_history" ("order_id");
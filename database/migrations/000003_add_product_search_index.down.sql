@@ -0,0 +1 @@
+DROP INDEX IF EXISTS "product_search_idx";
@@ -0,0 +1,5 @@
+CREATE INDEX "product_search_idx" ON "product" USING GIN ((
+  setweight(to_tsvector('english', coalesce("name", '')), 'A') ||
+  setweight(to_tsvector('english', coalesce("category", '')), 'B') ||
+  setweight(to_tsvector('english', coalesce("description", '')), 'C')
+));
@@ -0,0 +1,2 @@
+ALTER TABLE "order" DROP COLUMN IF EXISTS "version";
+ALTER TABLE "product" DROP COLUMN IF EXISTS "version";
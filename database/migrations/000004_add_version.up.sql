@@ -0,0 +1,2 @@
+ALTER TABLE "product" ADD COLUMN "version" int NOT NULL DEFAULT 1;
+ALTER TABLE "order" ADD COLUMN "version" int NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE "product" DROP COLUMN IF EXISTS "category_id";
+DROP TABLE IF EXISTS "category";
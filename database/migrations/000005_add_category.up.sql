@@ -0,0 +1,44 @@
+CREATE TABLE "category" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY NOT NULL,
+  "parent_id" int,
+  "name" varchar NOT NULL,
+  "slug" varchar NOT NULL,
+  "path" varchar NOT NULL,
+  "created_at" timestamp DEFAULT now(),
+  "updated_at" timestamp DEFAULT now()
+);
+
+ALTER TABLE "category" ADD FOREIGN KEY ("parent_id") REFERENCES "category" ("id");
+
+-- path is the materialized path of slugs from the root, e.g.
+-- "electronics/audio/headphones". varchar_pattern_ops lets subtree lookups
+-- with LIKE 'electronics/%' use the index.
+CREATE UNIQUE INDEX category_path_idx ON "category" ("path" varchar_pattern_ops);
+CREATE INDEX category_parent_id_idx ON "category" ("parent_id");
+
+-- every distinct product category becomes a root category
+INSERT INTO "category" ("name", "slug", "path")
+SELECT DISTINCT ON ("slug") "name", "slug", "slug"
+FROM (
+  SELECT
+    "category" AS "name",
+    coalesce(nullif(trim(BOTH '-' FROM regexp_replace(lower("category"), '[^a-z0-9]+', '-', 'g')), ''), 'uncategorized') AS "slug"
+  FROM "product"
+) c
+ORDER BY "slug", "name";
+
+ALTER TABLE "product" ADD COLUMN "category_id" int;
+
+UPDATE "product" p SET "category_id" = c."id"
+FROM "category" c
+WHERE c."parent_id" IS NULL
+  AND c."slug" = coalesce(nullif(trim(BOTH '-' FROM regexp_replace(lower(p."category"), '[^a-z0-9]+', '-', 'g')), ''), 'uncategorized');
+
+-- category stays as a copy of the category name for the search index
+UPDATE "product" p SET "category" = c."name"
+FROM "category" c
+WHERE c."id" = p."category_id";
+
+ALTER TABLE "product" ALTER COLUMN "category_id" SET NOT NULL;
+ALTER TABLE "product" ADD FOREIGN KEY ("category_id") REFERENCES "category" ("id");
+CREATE INDEX product_category_id_idx ON "product" ("category_id");
@@ -0,0 +1,21 @@
+CREATE TABLE "product_variant" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY NOT NULL,
+  "version" int NOT NULL DEFAULT 1,
+  "product_id" int NOT NULL,
+  "sku" varchar NOT NULL,
+  "options" jsonb NOT NULL DEFAULT '{}',
+  "price" decimal(10,2),
+  "count_in_stock" int NOT NULL DEFAULT 0,
+  "created_at" timestamp DEFAULT now(),
+  "updated_at" timestamp DEFAULT now(),
+  "deleted_at" timestamp
+);
+
+ALTER TABLE "product_variant" ADD FOREIGN KEY ("product_id") REFERENCES "product" ("id");
+
+CREATE INDEX product_variant_product_id_idx ON "product_variant" ("product_id");
+CREATE UNIQUE INDEX product_variant_sku_idx ON "product_variant" ("sku") WHERE "deleted_at" IS NULL;
+CREATE UNIQUE INDEX product_variant_options_idx ON "product_variant" ("product_id", "options") WHERE "deleted_at" IS NULL;
+
+ALTER TABLE "order_item" ADD COLUMN "variant_id" int;
+ALTER TABLE "order_item" ADD FOREIGN KEY ("variant_id") REFERENCES "product_variant" ("id");
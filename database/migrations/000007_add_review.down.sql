@@ -0,0 +1,2 @@
+ALTER TABLE "product" ALTER COLUMN "rating" DROP DEFAULT;
+DROP TABLE IF EXISTS "review";
@@ -0,0 +1,21 @@
+CREATE TABLE "review" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY NOT NULL,
+  "product_id" int NOT NULL,
+  "author" varchar NOT NULL,
+  "stars" int NOT NULL CHECK ("stars" BETWEEN 1 AND 5),
+  "title" varchar NOT NULL DEFAULT '',
+  "body" text NOT NULL DEFAULT '',
+  "status" varchar NOT NULL DEFAULT 'published',
+  "created_at" timestamp DEFAULT now(),
+  "updated_at" timestamp DEFAULT now(),
+  "deleted_at" timestamp
+);
+
+ALTER TABLE "review" ADD FOREIGN KEY ("product_id") REFERENCES "product" ("id");
+
+CREATE INDEX review_product_id_idx ON "review" ("product_id", "created_at", "id");
+
+-- rating and num_reviews are derived from the reviews from now on. There are
+-- no reviews yet, so the hand-set values are dropped.
+ALTER TABLE "product" ALTER COLUMN "rating" SET DEFAULT 0;
+UPDATE "product" SET "rating" = 0, "num_reviews" = 0;
@@ -0,0 +1,25 @@
+-- The stock ledger. created_at is a timestamptz so that the stock at a point in
+-- time given with any UTC offset sums up the right movements.
+CREATE TABLE "stock_movement" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY NOT NULL,
+  "product_id" int NOT NULL,
+  "variant_id" int,
+  "delta" int NOT NULL CHECK ("delta" <> 0),
+  "reason" varchar NOT NULL,
+  "order_id" int,
+  "actor" varchar NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "stock_movement" ADD FOREIGN KEY ("product_id") REFERENCES "product" ("id");
+ALTER TABLE "stock_movement" ADD FOREIGN KEY ("variant_id") REFERENCES "product_variant" ("id");
+ALTER TABLE "stock_movement" ADD FOREIGN KEY ("order_id") REFERENCES "order" ("id");
+
+CREATE INDEX stock_movement_product_id_idx ON "stock_movement" ("product_id", "variant_id", "created_at");
+
+-- The ledger starts with the stock as it is today.
+INSERT INTO "stock_movement" ("product_id", "delta", "reason")
+SELECT "id", "count_in_stock", 'adjustment' FROM "product" WHERE "count_in_stock" <> 0;
+
+INSERT INTO "stock_movement" ("product_id", "variant_id", "delta", "reason")
+SELECT "product_id", "id", "count_in_stock", 'adjustment' FROM "product_variant" WHERE "count_in_stock" <> 0;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "stock_alert";
+ALTER TABLE "product" DROP COLUMN IF EXISTS "reorder_threshold";
@@ -0,0 +1,18 @@
+-- 0 disables the low-stock alert of a product.
+ALTER TABLE "product" ADD COLUMN "reorder_threshold" int NOT NULL DEFAULT 0 CHECK ("reorder_threshold" >= 0);
+
+CREATE TABLE "stock_alert" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY NOT NULL,
+  "product_id" int NOT NULL,
+  "count_in_stock" int NOT NULL,
+  "reorder_threshold" int NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "notified_at" timestamp,
+  "resolved_at" timestamp
+);
+
+ALTER TABLE "stock_alert" ADD FOREIGN KEY ("product_id") REFERENCES "product" ("id");
+
+-- a product has at most one open alert
+CREATE UNIQUE INDEX stock_alert_open_idx ON "stock_alert" ("product_id") WHERE "resolved_at" IS NULL;
+CREATE INDEX stock_alert_created_at_idx ON "stock_alert" ("created_at", "id");
@@ -0,0 +1,21 @@
+-- The price history of a product. Its ranges [effective_from, effective_to)
+-- follow each other without gaps or overlaps, the last one is open ended.
+-- Ranges that start in the future are scheduled price changes. product.price
+-- caches the price that is effective now. The ranges are timestamptz so that
+-- they compare correctly against now() whatever the session time zone.
+CREATE TABLE "product_price" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY NOT NULL,
+  "product_id" int NOT NULL,
+  "price" decimal(10,2) NOT NULL CHECK ("price" >= 0),
+  "effective_from" timestamptz NOT NULL,
+  "effective_to" timestamptz CHECK ("effective_to" > "effective_from"),
+  "created_at" timestamp NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "product_price" ADD FOREIGN KEY ("product_id") REFERENCES "product" ("id");
+
+CREATE UNIQUE INDEX product_price_effective_from_idx ON "product_price" ("product_id", "effective_from");
+
+-- the history starts with the current prices
+INSERT INTO "product_price" ("product_id", "price", "effective_from")
+SELECT "id", "price", coalesce("created_at", now()) FROM "product";
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrCategoryNotFound error = apperror.NotFound("category_not_found", "category not found")
+	ErrCategoryExists   error = apperror.Conflict("category_exists", "a category with this slug already exists below the parent")
+	ErrCategoryNotEmpty error = apperror.Conflict("category_not_empty", "category still has subcategories or products")
+	ErrUnknownParent    error = apperror.Validation("unknown_parent", "parent category not found",
+		apperror.FieldError{Field: "parent_id", Message: "does not exist"})
+	ErrCategoryCycle error = apperror.Validation("category_cycle", "a category cannot be moved below itself",
+		apperror.FieldError{Field: "parent_id", Message: "must not be the category or one of its descendants"})
+)
+
+// selectCategorySubtree selects the ID of a category and of all its
+// descendants. It is written with a "?" placeholder for use in a whereClause.
+const selectCategorySubtree = `
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM category WHERE id = ?
+		UNION ALL
+		SELECT c.id FROM category c JOIN subtree s ON c.parent_id = s.id
+	)
+	SELECT id FROM subtree`
+
+// selectNamedCategories selects the IDs of the categories with a name or slug,
+// names are not unique across the tree.
+const selectNamedCategories = `SELECT id FROM category WHERE name = ? OR slug = ?`
+
+// selectNamedCategorySubtree is like selectCategorySubtree, starting from the
+// categories with a name or slug.
+const selectNamedCategorySubtree = `
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM category WHERE name = ? OR slug = ?
+		UNION ALL
+		SELECT c.id FROM category c JOIN subtree s ON c.parent_id = s.id
+	)
+	SELECT id FROM subtree`
+
+type CategoryRepository struct {
+	db *sqlx.DB
+}
+
+func NewCategoryRepository(db *sqlx.DB) *CategoryRepository {
+	return &CategoryRepository{
+		db: db,
+	}
+}
+
+func pqErrorCode(err error) pq.ErrorCode {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code
+	}
+
+	return ""
+}
+
+const (
+	uniqueViolation     pq.ErrorCode = "23505"
+	foreignKeyViolation pq.ErrorCode = "23503"
+)
+
+// categoryPath builds the path of a category with the given slug below the
+// parent. The parent is locked so that it cannot move while its new child is
+// written.
+func categoryPath(ctx context.Context, tx *sqlx.Tx, parentID *int64, slug string) (string, error) {
+	if parentID == nil {
+		return slug, nil
+	}
+
+	var parentPath string
+	err := tx.GetContext(ctx, &parentPath, "SELECT path FROM category WHERE id = $1 FOR SHARE", *parentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUnknownParent
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting parent category: %w", err)
+	}
+
+	return parentPath + "/" + slug, nil
+}
+
+const insertCategory = `
+	INSERT INTO category (parent_id, name, slug, path)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at
+`
+
+func (repo *CategoryRepository) CreateCategory(ctx context.Context, c *entity.Category) (*entity.Category, error) {
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		path, err := categoryPath(ctx, tx, c.ParentID, c.Slug)
+		if err != nil {
+			return err
+		}
+		c.Path = path
+
+		err = tx.QueryRowContext(ctx, insertCategory, c.ParentID, c.Name, c.Slug, c.Path).
+			Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
+		if pqErrorCode(err) == uniqueViolation {
+			return ErrCategoryExists
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating category: %w", err)
+	}
+
+	return c, nil
+}
+
+func (repo *CategoryRepository) GetCategory(ctx context.Context, id int64) (*entity.Category, error) {
+	var c entity.Category
+
+	err := repo.db.GetContext(ctx, &c, "SELECT * FROM category WHERE id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error getting category: %w", ErrCategoryNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting category: %w", err)
+	}
+
+	return &c, nil
+}
+
+// GetCategories returns the categories with the given IDs that exist.
+func (repo *CategoryRepository) GetCategories(ctx context.Context, ids []int64) ([]entity.Category, error) {
+	categories := []entity.Category{}
+	err := repo.db.SelectContext(ctx, &categories, "SELECT * FROM category WHERE id = ANY($1) ORDER BY id", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error getting categories: %w", err)
+	}
+
+	return categories, nil
+}
+
+// ListCategories returns every category ordered by path, so that a parent
+// always comes before its children.
+func (repo *CategoryRepository) ListCategories(ctx context.Context) ([]entity.Category, error) {
+	categories := []entity.Category{}
+	err := repo.db.SelectContext(ctx, &categories, "SELECT * FROM category ORDER BY path")
+	if err != nil {
+		return nil, fmt.Errorf("error listing categories: %w", err)
+	}
+
+	return categories, nil
+}
+
+const updateCategory = `
+	UPDATE category SET parent_id = $2, name = $3, slug = $4, path = $5, updated_at = now()
+	WHERE id = $1
+	RETURNING created_at, updated_at
+`
+
+// Slugs only consist of lowercase letters, digits and hyphens, so paths never
+// contain LIKE wildcards.
+const moveCategoryDescendants = `
+	UPDATE category SET path = $1 || substr(path, $2), updated_at = now()
+	WHERE path LIKE $3
+`
+
+const renameProductCategory = `
+	UPDATE product SET category = $1, version = version + 1, updated_at = now() WHERE category_id = $2
+`
+
+// UpdateCategory renames and moves the category. When its path changes the
+// paths of all descendants are rewritten, when its name changes the category
+// name copied into its products is updated.
+func (repo *CategoryRepository) UpdateCategory(ctx context.Context, c *entity.Category) (*entity.Category, error) {
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		var old entity.Category
+		err := tx.GetContext(ctx, &old, "SELECT * FROM category WHERE id = $1 FOR UPDATE", c.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCategoryNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error getting category: %w", err)
+		}
+
+		path, err := categoryPath(ctx, tx, c.ParentID, c.Slug)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(path, old.Path+"/") {
+			return ErrCategoryCycle
+		}
+		c.Path = path
+
+		err = tx.QueryRowContext(ctx, updateCategory, c.ID, c.ParentID, c.Name, c.Slug, c.Path).
+			Scan(&c.CreatedAt, &c.UpdatedAt)
+		if pqErrorCode(err) == uniqueViolation {
+			return ErrCategoryExists
+		}
+		if err != nil {
+			return err
+		}
+
+		if c.Path != old.Path {
+			_, err := tx.ExecContext(ctx, moveCategoryDescendants, c.Path, len(old.Path)+1, old.Path+"/%")
+			if err != nil {
+				return fmt.Errorf("error moving subcategories: %w", err)
+			}
+		}
+
+		if c.Name != old.Name {
+			_, err := tx.ExecContext(ctx, renameProductCategory, c.Name, c.ID)
+			if err != nil {
+				return fmt.Errorf("error renaming product category: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error updating category: %w", err)
+	}
+
+	return c, nil
+}
+
+const categoryInUse = `
+	SELECT EXISTS (SELECT 1 FROM category WHERE parent_id = $1)
+		OR EXISTS (SELECT 1 FROM product WHERE category_id = $1)
+`
+
+// DeleteCategory deletes a category without subcategories and products,
+// soft deleted products included.
+func (repo *CategoryRepository) DeleteCategory(ctx context.Context, id int64) error {
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		var inUse bool
+		if err := tx.GetContext(ctx, &inUse, categoryInUse, id); err != nil {
+			return err
+		}
+		if inUse {
+			return ErrCategoryNotEmpty
+		}
+
+		res, err := tx.ExecContext(ctx, "DELETE FROM category WHERE id = $1", id)
+		if pqErrorCode(err) == foreignKeyViolation {
+			return ErrCategoryNotEmpty
+		}
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrCategoryNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error deleting category: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	expectSelectParentPath = `SELECT path FROM category WHERE id = $1 FOR SHARE`
+	expectInsertCategory   = `INSERT INTO category (parent_id, name, slug, path) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
+	expectLockCategory     = `SELECT * FROM category WHERE id = $1 FOR UPDATE`
+	expectUpdateCategory   = `UPDATE category SET parent_id = $2, name = $3, slug = $4, path = $5, updated_at = now() WHERE id = $1 RETURNING created_at, updated_at`
+	expectMoveDescendants  = `UPDATE category SET path = $1 || substr(path, $2), updated_at = now() WHERE path LIKE $3`
+	expectRenameProducts   = `UPDATE product SET category = $1, version = version + 1, updated_at = now() WHERE category_id = $2`
+	expectCategoryInUse    = `SELECT EXISTS (SELECT 1 FROM category WHERE parent_id = $1) OR EXISTS (SELECT 1 FROM product WHERE category_id = $1)`
+	expectDeleteCategory   = `DELETE FROM category WHERE id = $1`
+)
+
+var categoryCols = []string{"id", "parent_id", "name", "slug", "path", "created_at", "updated_at"}
+
+func TestCreateCategory(t *testing.T) {
+	parentID := int64(1)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *CategoryRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "root category",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertCategory).
+					WithArgs(nil, "Electronics", "electronics", "electronics").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(1, now, now))
+				mock.ExpectCommit()
+
+				c, err := repo.CreateCategory(context.Background(), &entity.Category{Name: "Electronics", Slug: "electronics"})
+				require.NoError(t, err)
+				require.Equal(t, int64(1), c.ID)
+				require.Equal(t, "electronics", c.Path)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "subcategory",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectSelectParentPath).WithArgs(parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"path"}).AddRow("electronics"))
+				mock.ExpectQuery(expectInsertCategory).
+					WithArgs(parentID, "Audio", "audio", "electronics/audio").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(2, now, now))
+				mock.ExpectCommit()
+
+				c, err := repo.CreateCategory(context.Background(), &entity.Category{ParentID: &parentID, Name: "Audio", Slug: "audio"})
+				require.NoError(t, err)
+				require.Equal(t, "electronics/audio", c.Path)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown parent",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectSelectParentPath).WithArgs(parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"path"}))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateCategory(context.Background(), &entity.Category{ParentID: &parentID, Name: "Audio", Slug: "audio"})
+				require.ErrorIs(t, err, ErrUnknownParent)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "duplicate slug",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertCategory).
+					WithArgs(nil, "Electronics", "electronics", "electronics").
+					WillReturnError(&pq.Error{Code: uniqueViolation})
+				mock.ExpectRollback()
+
+				_, err := repo.CreateCategory(context.Background(), &entity.Category{Name: "Electronics", Slug: "electronics"})
+				require.ErrorIs(t, err, ErrCategoryExists)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewCategoryRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestUpdateCategory(t *testing.T) {
+	now := time.Now()
+	rootID, audioID := int64(1), int64(2)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *CategoryRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "move and rename",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockCategory).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows(categoryCols).AddRow(3, audioID, "Headphones", "headphones", "electronics/audio/headphones", now, now))
+				mock.ExpectQuery(expectSelectParentPath).WithArgs(rootID).
+					WillReturnRows(sqlmock.NewRows([]string{"path"}).AddRow("electronics"))
+				mock.ExpectQuery(expectUpdateCategory).
+					WithArgs(3, rootID, "Headsets", "headsets", "electronics/headsets").
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+				mock.ExpectExec(expectMoveDescendants).
+					WithArgs("electronics/headsets", len("electronics/audio/headphones")+1, "electronics/audio/headphones/%").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(expectRenameProducts).WithArgs("Headsets", 3).WillReturnResult(sqlmock.NewResult(0, 5))
+				mock.ExpectCommit()
+
+				c, err := repo.UpdateCategory(context.Background(), &entity.Category{ID: 3, ParentID: &rootID, Name: "Headsets", Slug: "headsets"})
+				require.NoError(t, err)
+				require.Equal(t, "electronics/headsets", c.Path)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "moved below itself",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockCategory).WithArgs(audioID).
+					WillReturnRows(sqlmock.NewRows(categoryCols).AddRow(audioID, rootID, "Audio", "audio", "electronics/audio", now, now))
+				mock.ExpectQuery(expectSelectParentPath).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"path"}).AddRow("electronics/audio/headphones"))
+				mock.ExpectRollback()
+
+				parentID := int64(3)
+				_, err := repo.UpdateCategory(context.Background(), &entity.Category{ID: audioID, ParentID: &parentID, Name: "Audio", Slug: "audio"})
+				require.ErrorIs(t, err, ErrCategoryCycle)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "category not found",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockCategory).WithArgs(9).WillReturnRows(sqlmock.NewRows(categoryCols))
+				mock.ExpectRollback()
+
+				_, err := repo.UpdateCategory(context.Background(), &entity.Category{ID: 9, Name: "Audio", Slug: "audio"})
+				require.ErrorIs(t, err, ErrCategoryNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewCategoryRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestDeleteCategory(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *CategoryRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectCategoryInUse).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"in_use"}).AddRow(false))
+				mock.ExpectExec(expectDeleteCategory).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := repo.DeleteCategory(context.Background(), 1)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "category in use",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectCategoryInUse).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"in_use"}).AddRow(true))
+				mock.ExpectRollback()
+
+				err := repo.DeleteCategory(context.Background(), 1)
+				require.ErrorIs(t, err, ErrCategoryNotEmpty)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "category not found",
+			test: func(t *testing.T, repo *CategoryRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectCategoryInUse).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"in_use"}).AddRow(false))
+				mock.ExpectExec(expectDeleteCategory).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := repo.DeleteCategory(context.Background(), 1)
+				require.ErrorIs(t, err, ErrCategoryNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewCategoryRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
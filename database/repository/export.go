@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// streamRows runs query and hands every row to fn as soon as it is scanned, so
+// that only a single row is held in memory. fn returning an error stops the
+// iteration.
+func streamRows[T any](ctx context.Context, db *sqlx.DB, query string, args []interface{}, fn func(*T) error) error {
+	rows, err := db.QueryxContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v T
+		if err := rows.StructScan(&v); err != nil {
+			return err
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExportProducts streams every product matching the filter to fn, in the
+// filter's sort order or else by (created_at, id).
+func (repo *ProductRepository) ExportProducts(ctx context.Context, filter entity.ProductFilter, fn func(*entity.Product) error) error {
+	orderBy, err := orderByClause(filter.Sort, productSortColumns)
+	if err != nil {
+		return err
+	}
+	if orderBy == "" {
+		orderBy = "created_at, id"
+	}
+
+	where := productWhere(filter)
+	err = streamRows(ctx, repo.db, "SELECT * FROM product"+where.String()+" ORDER BY "+orderBy, where.args, fn)
+	if err != nil {
+		return fmt.Errorf("error exporting products: %w", err)
+	}
+
+	return nil
+}
+
+// ExportOrders streams every order matching the filter to fn by (created_at,
+// id). Orders and their items come from a single JOIN query sorted by order,
+// so an order is complete once a row of the next order is read.
+func (repo *OrderRepository) ExportOrders(ctx context.Context, filter entity.OrderFilter, fn func(*entity.Order) error) error {
+	var where whereClause
+	if !filter.IncludeDeleted {
+		where.add("o.deleted_at IS NULL")
+	}
+
+	var current *entity.Order
+	err := streamRows(ctx, repo.db, selectOrdersWithItems+where.String()+" ORDER BY o.created_at, o.id, oi.id", where.args,
+		func(row *orderWithItemRow) error {
+			if current != nil && current.ID != row.ID {
+				if err := fn(current); err != nil {
+					return err
+				}
+				current = nil
+			}
+			if current == nil {
+				o := row.Order
+				o.Items = []entity.OrderItem{}
+				current = &o
+			}
+			if item, ok := row.item(); ok {
+				current.Items = append(current.Items, item)
+			}
+
+			return nil
+		})
+	if err == nil && current != nil {
+		err = fn(current)
+	}
+	if err != nil {
+		return fmt.Errorf("error exporting orders: %w", err)
+	}
+
+	return nil
+}
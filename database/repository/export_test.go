@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportProducts(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL AND category_id IN ( " +
+					"WITH RECURSIVE subtree AS ( SELECT id FROM category WHERE id = $1 " +
+					"UNION ALL SELECT c.id FROM category c JOIN subtree s ON c.parent_id = s.id ) " +
+					"SELECT id FROM subtree) ORDER BY price DESC, id ASC").
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "category", "price"}).
+						AddRow(2, "test product 2", "test category", 100.0).
+						AddRow(1, "test product", "test category", 50.0))
+
+				var ids []int64
+				categoryID := int64(3)
+				filter := entity.ProductFilter{
+					CategoryID:         &categoryID,
+					IncludeDescendants: true,
+					Sort:               []entity.SortField{{Field: "price", Desc: true}},
+				}
+				err := repo.ExportProducts(context.Background(), filter, func(p *entity.Product) error {
+					ids = append(ids, p.ID)
+					return nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, []int64{2, 1}, ids)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "stopped by callback",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL ORDER BY created_at, id").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+				calls := 0
+				err := repo.ExportProducts(context.Background(), entity.ProductFilter{}, func(p *entity.Product) error {
+					calls++
+					return fmt.Errorf("client went away")
+				})
+				require.Error(t, err)
+				require.Equal(t, 1, calls)
+			},
+		},
+		{
+			name: "invalid sort",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				filter := entity.ProductFilter{Sort: []entity.SortField{{Field: "secret"}}}
+				err := repo.ExportProducts(context.Background(), filter, func(p *entity.Product) error { return nil })
+				require.ErrorIs(t, err, ErrInvalidSort)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestExportOrders(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		repo := NewOrderRepository(db)
+		now := time.Now()
+		cols := []string{"id", "version", "created_at", "updated_at", "deleted_at", "status", "payment_method", "tax_price", "shipping_price", "total_price",
+			"item_id", "item_created_at", "item_updated_at", "item_deleted_at", "item_name", "item_quantity", "item_image", "item_price", "item_product_id"}
+
+		mock.ExpectQuery(`SELECT o.id, o.version, o.created_at, o.updated_at, o.deleted_at, o.status, o.payment_method, o.tax_price, o.shipping_price, o.total_price, ` +
+			`oi.id AS item_id, oi.created_at AS item_created_at, oi.updated_at AS item_updated_at, oi.deleted_at AS item_deleted_at, oi.name AS item_name, ` +
+			`oi.quantity AS item_quantity, oi.image AS item_image, oi.price AS item_price, oi.product_id AS item_product_id, oi.variant_id AS item_variant_id ` +
+			`FROM "order" o LEFT JOIN order_item oi ON oi.order_id = o.id WHERE o.deleted_at IS NULL ORDER BY o.created_at, o.id, oi.id`).
+			WillReturnRows(sqlmock.NewRows(cols).
+				AddRow(1, 1, now, now, nil, "pending", "card", 11.0, 10.0, 121.0, 10, now, now, nil, "test product", 1, "test.png", 100.0, 1).
+				AddRow(1, 1, now, now, nil, "pending", "card", 11.0, 10.0, 121.0, 11, now, now, nil, "test product 2", 2, "test2.png", 50.0, 2).
+				AddRow(2, 1, now, now, nil, "pending", "card", 0.0, 10.0, 10.0, nil, nil, nil, nil, nil, nil, nil, nil, nil))
+
+		var orders []entity.Order
+		err := repo.ExportOrders(context.Background(), entity.OrderFilter{}, func(o *entity.Order) error {
+			orders = append(orders, *o)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Len(t, orders[0].Items, 2)
+		require.Equal(t, int64(11), orders[0].Items[1].ID)
+		require.Equal(t, int64(1), orders[0].Items[1].OrderID)
+		require.Empty(t, orders[1].Items)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
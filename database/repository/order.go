@@ -1,13 +1,48 @@
 package repository
 
 import (
+	"chi-sqlx/apperror"
 	"chi-sqlx/database/entity"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// taxRate is applied to the items subtotal when an order is priced.
+const taxRate = 0.11
+
+var (
+	ErrOrderNotFound      error = apperror.NotFound("order_not_found", "order not found")
+	ErrOrderStatusChanged error = apperror.Conflict("order_status_changed", "order status was changed concurrently")
+)
+
+// OutOfStockError is returned when an order asks for more units of a product
+// than are currently in stock. VariantID is set when the variant ran out.
+type OutOfStockError struct {
+	ProductID int64
+	VariantID *int64
+	Requested int64
+	Available int64
+}
+
+func (e *OutOfStockError) Error() string {
+	if e.VariantID != nil {
+		return fmt.Sprintf("variant %d of product %d is out of stock: requested %d, available %d", *e.VariantID, e.ProductID, e.Requested, e.Available)
+	}
+
+	return fmt.Sprintf("product %d is out of stock: requested %d, available %d", e.ProductID, e.Requested, e.Available)
+}
+
+func (e *OutOfStockError) Unwrap() error {
+	return apperror.OutOfStock("out_of_stock", e.Error())
+}
+
 type OrderRepository struct {
 	db *sqlx.DB
 }
@@ -18,42 +53,81 @@ func NewOrderRepository(db *sqlx.DB) *OrderRepository {
 	}
 }
 
-func (repo *OrderRepository) execTx(ctx context.Context, fn func(*sqlx.Tx) error) error {
-	tx, err := repo.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("error starting transaction: %v", err)
-	}
+// "order" is a reserved word in PostgreSQL, so the table name must always be quoted.
+const insertOrder = `
+	INSERT INTO "order" (payment_method, tax_price, shipping_price, total_price)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, version, created_at, updated_at
+`
+
+// Products are locked in ID order so that concurrent orders touching the same
+// products cannot deadlock each other. The price is the one effective at the
+// time of the order according to the price history, product.price may still
+// lag behind a scheduled change.
+const selectProductsForUpdate = `
+	SELECT p.id, p.name, p.image, COALESCE(pp.price, p.price) AS price, p.count_in_stock
+	FROM product p
+	LEFT JOIN product_price pp ON pp.product_id = p.id
+		AND pp.effective_from <= now() AND (pp.effective_to IS NULL OR pp.effective_to > now())
+	WHERE p.id = ANY($1) AND p.deleted_at IS NULL
+	ORDER BY p.id
+	FOR UPDATE OF p
+`
+
+// Variants are locked after their products, again in ID order.
+const selectVariantsForUpdate = `
+	SELECT id, product_id, options, price, count_in_stock
+	FROM product_variant
+	WHERE id = ANY($1) AND deleted_at IS NULL
+	ORDER BY id
+	FOR UPDATE
+`
+
+const decrementProductStock = `
+	UPDATE product SET count_in_stock = count_in_stock - $1, version = version + 1, updated_at = now()
+	WHERE id = $2
+`
+
+const decrementVariantStock = `
+	UPDATE product_variant SET count_in_stock = count_in_stock - $1, version = version + 1, updated_at = now()
+	WHERE id = $2
+`
+
+const insertOrderItem = `
+	INSERT INTO order_item (name, quantity, image, price, product_id, variant_id, order_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at, updated_at
+`
 
-	err = fn(tx)
-	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			return fmt.Errorf("error rolling back transaction: %v", rbErr)
+func (repo *OrderRepository) CreateOrder(ctx context.Context, o *entity.Order) (*entity.Order, error) {
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		// price the order from the product table and reserve stock
+		sales, err := reserveOrderItems(ctx, tx, o)
+		if err != nil {
+			return fmt.Errorf("error reserving order items: %w", err)
 		}
 
-		return fmt.Errorf("error in transaction: %v", err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %v", err)
-	}
-
-	return nil
-}
-
-func (repo *OrderRepository) CreateOrder(ctx context.Context, o *entity.Order) (*entity.Order, error) {
-	err := repo.execTx(ctx, func(tx *sqlx.Tx) error {
 		// insert into order
 		order, err := createOrder(ctx, tx, o)
 		if err != nil {
-			return fmt.Errorf("error creating order: %v", err)
+			return fmt.Errorf("error creating order: %w", err)
+		}
+
+		for _, m := range sales {
+			m.OrderID = &order.ID
+		}
+		err = recordStockMovements(ctx, tx, sales)
+		if err != nil {
+			return fmt.Errorf("error recording sales: %w", err)
 		}
 
-		for _, oi := range o.Items {
+		for i := range o.Items {
+			oi := &o.Items[i]
 			oi.OrderID = order.ID
 			// insert into order item
 			err = createOrderItem(ctx, tx, oi)
 			if err != nil {
-				return fmt.Errorf("error creating order items: %v", err)
+				return fmt.Errorf("error creating order items: %w", err)
 			}
 		}
 
@@ -61,53 +135,191 @@ func (repo *OrderRepository) CreateOrder(ctx context.Context, o *entity.Order) (
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error creating order: %v", err)
+		return nil, fmt.Errorf("error creating order: %w", err)
 	}
 
 	return o, nil
 }
 
-func createOrder(ctx context.Context, tx *sqlx.Tx, o *entity.Order) (*entity.Order, error) {
-	res, err := tx.NamedExecContext(ctx, "INSERT INTO order (payment_method, tax_price, shipping_price, total_price) VALUES (:payment_method, :tax_price, :shipping_price, :total_price)", o)
-	if err != nil {
-		return nil, fmt.Errorf("error inserting order: %v", err)
+// reserveOrderItems locks every product and variant referenced by the order,
+// copies the authoritative name, image and price onto the items, decrements
+// stock and computes the order totals. Client supplied prices are ignored.
+// Items with a variant take their stock from the variant, not the product.
+// The returned sales still have to be recorded in the stock ledger once the
+// order has an ID.
+func reserveOrderItems(ctx context.Context, tx *sqlx.Tx, o *entity.Order) ([]*entity.StockMovement, error) {
+	var ids, variantIDs []int64
+	seen := make(map[int64]bool)
+	quantities := make(map[int64]int64)
+	variantQuantities := make(map[int64]int64)
+	for i, oi := range o.Items {
+		if oi.Quantity <= 0 {
+			return nil, apperror.Validation("invalid_quantity", fmt.Sprintf("invalid quantity %d for product %d", oi.Quantity, oi.ProductID),
+				apperror.FieldError{Field: fmt.Sprintf("items[%d].quantity", i), Message: "must be greater than zero"})
+		}
+		if !seen[oi.ProductID] {
+			seen[oi.ProductID] = true
+			ids = append(ids, oi.ProductID)
+		}
+		if oi.VariantID == nil {
+			quantities[oi.ProductID] += oi.Quantity
+			continue
+		}
+		if _, ok := variantQuantities[*oi.VariantID]; !ok {
+			variantIDs = append(variantIDs, *oi.VariantID)
+		}
+		variantQuantities[*oi.VariantID] += oi.Quantity
 	}
 
-	id, err := res.LastInsertId()
+	var products []entity.Product
+	err := tx.SelectContext(ctx, &products, selectProductsForUpdate, pq.Array(ids))
 	if err != nil {
-		return nil, fmt.Errorf("error getting last insert ID: %v", err)
+		return nil, fmt.Errorf("error locking products: %w", err)
 	}
-	o.ID = id
 
-	return o, nil
+	byID := make(map[int64]entity.Product, len(products))
+	for _, p := range products {
+		if p.CountInStock < quantities[p.ID] {
+			return nil, &OutOfStockError{ProductID: p.ID, Requested: quantities[p.ID], Available: p.CountInStock}
+		}
+		byID[p.ID] = p
+	}
+
+	var variants []entity.ProductVariant
+	if len(variantIDs) > 0 {
+		err = tx.SelectContext(ctx, &variants, selectVariantsForUpdate, pq.Array(variantIDs))
+		if err != nil {
+			return nil, fmt.Errorf("error locking variants: %w", err)
+		}
+	}
+
+	variantsByID := make(map[int64]entity.ProductVariant, len(variants))
+	for _, v := range variants {
+		variantsByID[v.ID] = v
+	}
+
+	var subtotal float64
+	for i := range o.Items {
+		oi := &o.Items[i]
+		p, ok := byID[oi.ProductID]
+		if !ok {
+			// a missing product is a problem with the order, not a missing order
+			return nil, &apperror.Error{
+				Kind:    apperror.ErrValidation,
+				Code:    "unknown_product",
+				Message: fmt.Sprintf("product %d does not exist", oi.ProductID),
+				Fields:  []apperror.FieldError{{Field: fmt.Sprintf("items[%d].product_id", i), Message: "product does not exist"}},
+				Err:     ErrProductNotFound,
+			}
+		}
+
+		oi.Name = p.Name
+		oi.Image = p.Image
+		oi.Price = p.Price
+
+		if oi.VariantID != nil {
+			v, ok := variantsByID[*oi.VariantID]
+			if !ok || v.ProductID != p.ID {
+				return nil, &apperror.Error{
+					Kind:    apperror.ErrValidation,
+					Code:    "unknown_variant",
+					Message: fmt.Sprintf("product %d has no variant %d", oi.ProductID, *oi.VariantID),
+					Fields:  []apperror.FieldError{{Field: fmt.Sprintf("items[%d].variant_id", i), Message: "variant does not exist"}},
+					Err:     ErrVariantNotFound,
+				}
+			}
+			if v.CountInStock < variantQuantities[v.ID] {
+				return nil, &OutOfStockError{ProductID: p.ID, VariantID: &v.ID, Requested: variantQuantities[v.ID], Available: v.CountInStock}
+			}
+
+			if len(v.Options) > 0 {
+				oi.Name = fmt.Sprintf("%s (%s)", p.Name, v.Options)
+			}
+			if v.Price != nil {
+				oi.Price = *v.Price
+			}
+		}
+
+		subtotal += oi.Price * float64(oi.Quantity)
+	}
+
+	var sales []*entity.StockMovement
+	for _, p := range products {
+		if quantities[p.ID] == 0 {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, decrementProductStock, quantities[p.ID], p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error decrementing stock: %w", err)
+		}
+		sales = append(sales, &entity.StockMovement{ProductID: p.ID, Delta: -quantities[p.ID], Reason: entity.StockReasonSale})
+	}
+
+	for _, v := range variants {
+		_, err := tx.ExecContext(ctx, decrementVariantStock, variantQuantities[v.ID], v.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error decrementing variant stock: %w", err)
+		}
+		sales = append(sales, &entity.StockMovement{ProductID: v.ProductID, VariantID: &v.ID, Delta: -variantQuantities[v.ID], Reason: entity.StockReasonSale})
+	}
+
+	o.TaxPrice = roundPrice(subtotal * taxRate)
+	o.TotalPrice = roundPrice(subtotal + o.TaxPrice + o.ShippingPrice)
+
+	return sales, nil
 }
 
-func createOrderItem(ctx context.Context, tx *sqlx.Tx, oi entity.OrderItem) error {
-	res, err := tx.NamedExecContext(ctx, "INSERT INTO order_item (name, quantity, image, price, product_id, order_id) VALUES (:name, :quantity, :image, :price, :product_id, :order_id)", oi)
+func roundPrice(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func createOrder(ctx context.Context, tx *sqlx.Tx, o *entity.Order) (*entity.Order, error) {
+	err := tx.QueryRowContext(ctx, insertOrder,
+		o.PaymentMethod,
+		o.TaxPrice,
+		o.ShippingPrice,
+		o.TotalPrice).
+		Scan(&o.ID, &o.Version, &o.CreatedAt, &o.UpdatedAt)
+
 	if err != nil {
-		return fmt.Errorf("error inserting order item: %v", err)
+		return nil, fmt.Errorf("error inserting order: %w", err)
 	}
 
-	id, err := res.LastInsertId()
+	return o, nil
+}
+
+func createOrderItem(ctx context.Context, tx *sqlx.Tx, oi *entity.OrderItem) error {
+	err := tx.QueryRowContext(ctx, insertOrderItem,
+		oi.Name,
+		oi.Quantity,
+		oi.Image,
+		oi.Price,
+		oi.ProductID,
+		oi.VariantID,
+		oi.OrderID).
+		Scan(&oi.ID, &oi.CreatedAt, &oi.UpdatedAt)
+
 	if err != nil {
-		return fmt.Errorf("error getting last insert ID: %v", err)
+		return fmt.Errorf("error inserting order item: %w", err)
 	}
-	oi.ID = id
 
 	return nil
 }
 
 func (repo *OrderRepository) GetOrder(ctx context.Context, id int64) (*entity.Order, error) {
 	var o entity.Order
-	err := repo.db.GetContext(ctx, &o, "SELECT * FROM order WHERE id=?", id)
+	err := repo.db.GetContext(ctx, &o, `SELECT * FROM "order" WHERE id=$1 AND deleted_at IS NULL`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error getting order: %w", ErrOrderNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error getting order: %v", err)
+		return nil, fmt.Errorf("error getting order: %w", err)
 	}
 
 	var oi []entity.OrderItem
-	err = repo.db.SelectContext(ctx, &oi, "SELECT * FROM order_item WHERE order_id=?", id)
+	err = repo.db.SelectContext(ctx, &oi, "SELECT * FROM order_item WHERE order_id=$1", id)
 	if err != nil {
-		return nil, fmt.Errorf("error getting order items: %v", err)
+		return nil, fmt.Errorf("error getting order items: %w", err)
 	}
 
 	o.Items = oi
@@ -115,43 +327,356 @@ func (repo *OrderRepository) GetOrder(ctx context.Context, id int64) (*entity.Or
 	return &o, nil
 }
 
-func (repo *OrderRepository) ListOrders(ctx context.Context) ([]entity.Order, error) {
-	var orders []entity.Order
-	err := repo.db.SelectContext(ctx, &orders, "SELECT * FROM order")
+const selectOrdersWithItems = `
+	SELECT
+		o.id, o.version, o.created_at, o.updated_at, o.deleted_at, o.status,
+		o.payment_method, o.tax_price, o.shipping_price, o.total_price,
+		oi.id AS item_id, oi.created_at AS item_created_at, oi.updated_at AS item_updated_at,
+		oi.deleted_at AS item_deleted_at, oi.name AS item_name, oi.quantity AS item_quantity,
+		oi.image AS item_image, oi.price AS item_price, oi.product_id AS item_product_id,
+		oi.variant_id AS item_variant_id
+	FROM "order" o
+	LEFT JOIN order_item oi ON oi.order_id = o.id
+`
+
+const selectOrderWithItems = selectOrdersWithItems + `
+	WHERE o.id = $1
+`
+
+// orderWithItemRow is one row of selectOrderWithItems. The item columns are
+// nullable because an order without items still yields a single row.
+type orderWithItemRow struct {
+	entity.Order
+	ItemID        sql.NullInt64   `db:"item_id"`
+	ItemCreatedAt sql.NullTime    `db:"item_created_at"`
+	ItemUpdatedAt sql.NullTime    `db:"item_updated_at"`
+	ItemDeletedAt *time.Time      `db:"item_deleted_at"`
+	ItemName      sql.NullString  `db:"item_name"`
+	ItemQuantity  sql.NullInt64   `db:"item_quantity"`
+	ItemImage     sql.NullString  `db:"item_image"`
+	ItemPrice     sql.NullFloat64 `db:"item_price"`
+	ItemProductID sql.NullInt64   `db:"item_product_id"`
+	ItemVariantID *int64          `db:"item_variant_id"`
+}
+
+// item returns the item of the row, false for an order without items.
+func (row *orderWithItemRow) item() (entity.OrderItem, bool) {
+	if !row.ItemID.Valid {
+		return entity.OrderItem{}, false
+	}
+
+	return entity.OrderItem{
+		ID:        row.ItemID.Int64,
+		CreatedAt: row.ItemCreatedAt.Time,
+		UpdatedAt: row.ItemUpdatedAt.Time,
+		DeletedAt: row.ItemDeletedAt,
+		Name:      row.ItemName.String,
+		Quantity:  row.ItemQuantity.Int64,
+		Image:     row.ItemImage.String,
+		Price:     row.ItemPrice.Float64,
+		ProductID: row.ItemProductID.Int64,
+		VariantID: row.ItemVariantID,
+		OrderID:   row.ID,
+	}, true
+}
+
+// GetOrderWithItems fetches the order and its items with a single JOIN query.
+func (repo *OrderRepository) GetOrderWithItems(ctx context.Context, id int64) (*entity.Order, error) {
+	return repo.getOrderWithItems(ctx, id, false)
+}
+
+// GetOrderWithDeleted is like GetOrderWithItems but also finds soft deleted orders.
+func (repo *OrderRepository) GetOrderWithDeleted(ctx context.Context, id int64) (*entity.Order, error) {
+	return repo.getOrderWithItems(ctx, id, true)
+}
+
+func (repo *OrderRepository) getOrderWithItems(ctx context.Context, id int64, includeDeleted bool) (*entity.Order, error) {
+	query := selectOrderWithItems
+	if !includeDeleted {
+		query += " AND o.deleted_at IS NULL"
+	}
+
+	var rows []orderWithItemRow
+	err := repo.db.SelectContext(ctx, &rows, query+" ORDER BY oi.id", id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting order: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("error getting order: %w", ErrOrderNotFound)
+	}
+
+	o := rows[0].Order
+	o.Items = make([]entity.OrderItem, 0, len(rows))
+	for _, row := range rows {
+		if item, ok := row.item(); ok {
+			o.Items = append(o.Items, item)
+		}
+	}
+
+	return &o, nil
+}
+
+func (repo *OrderRepository) ListOrders(ctx context.Context, filter entity.OrderFilter, page entity.Pagination) (*entity.Page[entity.Order], error) {
+	var where whereClause
+	if !filter.IncludeDeleted {
+		where.add("deleted_at IS NULL")
+	}
+
+	orders, err := paginate(ctx, repo.db, `"order"`, where, "", page, orderCursor)
+	if err != nil {
+		return nil, fmt.Errorf("error listing order: %w", err)
+	}
+
+	err = repo.loadOrderItems(ctx, orders.Items)
 	if err != nil {
-		return nil, fmt.Errorf("error listing order: %v", err)
+		return nil, err
 	}
 
+	return orders, nil
+}
+
+func orderCursor(o entity.Order) entity.Cursor {
+	return entity.Cursor{CreatedAt: o.CreatedAt, ID: o.ID}
+}
+
+// loadOrderItems fetches the items of all given orders in one query and
+// attaches them to the matching order.
+func (repo *OrderRepository) loadOrderItems(ctx context.Context, orders []entity.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(orders))
+	index := make(map[int64]int, len(orders))
 	for i := range orders {
-		var items []entity.OrderItem
-		err := repo.db.SelectContext(ctx, &items, "SELECT * FROM order_item WHERE order_id=?", orders[i].ID)
+		ids[i] = orders[i].ID
+		index[orders[i].ID] = i
+		orders[i].Items = []entity.OrderItem{}
+	}
+
+	var items []entity.OrderItem
+	err := repo.db.SelectContext(ctx, &items, "SELECT * FROM order_item WHERE order_id = ANY($1) ORDER BY order_id, id", pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error getting order items: %w", err)
+	}
+
+	for _, oi := range items {
+		if i, ok := index[oi.OrderID]; ok {
+			orders[i].Items = append(orders[i].Items, oi)
+		}
+	}
+
+	return nil
+}
+
+const updateOrderStatus = `
+	UPDATE "order" SET status = $1, version = version + 1, updated_at = now()
+	WHERE id = $2 AND status = $3
+	RETURNING updated_at
+`
+
+const insertOrderStatusHistory = `
+	INSERT INTO order_status_history (order_id, from_status, to_status, reason)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at
+`
+
+// UpdateOrderStatus moves the order from one status to another and records the
+// change in order_status_history. The update only applies while the order is
+// still in the from status, otherwise ErrOrderStatusChanged is returned.
+func (repo *OrderRepository) UpdateOrderStatus(ctx context.Context, id int64, from, to entity.OrderStatus, reason string) (*entity.OrderStatusHistory, error) {
+	h := &entity.OrderStatusHistory{
+		OrderID:    id,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+	}
+
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		return changeOrderStatus(ctx, tx, h)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error updating order status: %w", err)
+	}
+
+	return h, nil
+}
+
+func changeOrderStatus(ctx context.Context, tx *sqlx.Tx, h *entity.OrderStatusHistory) error {
+	var updatedAt time.Time
+	err := tx.QueryRowContext(ctx, updateOrderStatus, h.ToStatus, h.OrderID, h.FromStatus).Scan(&updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOrderStatusChanged
+	}
+	if err != nil {
+		return fmt.Errorf("error updating order status: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx, insertOrderStatusHistory,
+		h.OrderID,
+		h.FromStatus,
+		h.ToStatus,
+		h.Reason).
+		Scan(&h.ID, &h.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("error inserting order status history: %w", err)
+	}
+
+	return nil
+}
+
+// Items of a variant go back into the stock of the variant, the others into
+// the stock of their product.
+const restoreOrderStock = `
+	UPDATE product p SET count_in_stock = p.count_in_stock + oi.quantity, version = p.version + 1, updated_at = now()
+	FROM (
+		SELECT product_id, SUM(quantity) AS quantity
+		FROM order_item
+		WHERE order_id = $1 AND variant_id IS NULL
+		GROUP BY product_id
+	) oi
+	WHERE p.id = oi.product_id
+`
+
+const restoreOrderVariantStock = `
+	UPDATE product_variant v SET count_in_stock = v.count_in_stock + oi.quantity, version = v.version + 1, updated_at = now()
+	FROM (
+		SELECT variant_id, SUM(quantity) AS quantity
+		FROM order_item
+		WHERE order_id = $1 AND variant_id IS NOT NULL
+		GROUP BY variant_id
+	) oi
+	WHERE v.id = oi.variant_id
+`
+
+// insertOrderReturns records the restored stock of a cancelled order in the
+// stock ledger.
+const insertOrderReturns = `
+	INSERT INTO stock_movement (product_id, variant_id, delta, reason, order_id)
+	SELECT product_id, variant_id, SUM(quantity), 'return', order_id
+	FROM order_item
+	WHERE order_id = $1
+	GROUP BY product_id, variant_id, order_id
+`
+
+// CancelOrder marks the order as cancelled and puts the quantities of all its
+// items back into stock in a single transaction.
+func (repo *OrderRepository) CancelOrder(ctx context.Context, id int64, from entity.OrderStatus, reason string) (*entity.OrderStatusHistory, error) {
+	h := &entity.OrderStatusHistory{
+		OrderID:    id,
+		FromStatus: from,
+		ToStatus:   entity.OrderStatusCancelled,
+		Reason:     reason,
+	}
+
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		err := changeOrderStatus(ctx, tx, h)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, restoreOrderStock, id)
 		if err != nil {
-			return nil, fmt.Errorf("error getting order items: %v", err)
+			return fmt.Errorf("error restoring stock: %w", err)
 		}
-		orders[i].Items = items
+
+		_, err = tx.ExecContext(ctx, restoreOrderVariantStock, id)
+		if err != nil {
+			return fmt.Errorf("error restoring variant stock: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, insertOrderReturns, id)
+		if err != nil {
+			return fmt.Errorf("error recording returns: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error cancelling order: %w", err)
 	}
 
-	return orders, nil
+	return h, nil
 }
 
+func (repo *OrderRepository) ListOrderStatusHistory(ctx context.Context, orderID int64) ([]entity.OrderStatusHistory, error) {
+	var history []entity.OrderStatusHistory
+	err := repo.db.SelectContext(ctx, &history, "SELECT * FROM order_status_history WHERE order_id=$1 ORDER BY created_at, id", orderID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing order status history: %w", err)
+	}
+
+	return history, nil
+}
+
+// DeleteOrder soft deletes the order together with its items.
 func (repo *OrderRepository) DeleteOrder(ctx context.Context, id int64) error {
-	err := repo.execTx(ctx, func(tx *sqlx.Tx) error {
-		_, err := tx.ExecContext(ctx, "DELETE FROM order_item WHERE order_id=?", id)
+	return repo.deleteOrder(ctx, id, nil)
+}
+
+// DeleteOrderIfVersion is like DeleteOrder but only deletes the order while it
+// is still at the given version.
+func (repo *OrderRepository) DeleteOrderIfVersion(ctx context.Context, id, version int64) error {
+	return repo.deleteOrder(ctx, id, &version)
+}
+
+func (repo *OrderRepository) deleteOrder(ctx context.Context, id int64, version *int64) error {
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		var where whereClause
+		where.add("id = ?", id)
+		where.add("deleted_at IS NULL")
+		if version != nil {
+			where.add("version = ?", *version)
+		}
+
+		query := sqlx.Rebind(sqlx.DOLLAR, `UPDATE "order" SET deleted_at = now(), version = version + 1`+where.String())
+		res, err := tx.ExecContext(ctx, query, where.args...)
+		if err != nil {
+			return fmt.Errorf("error deleting order: %w", err)
+		}
+
+		n, err := res.RowsAffected()
 		if err != nil {
-			return fmt.Errorf("error deleting order items: %v", err)
+			return fmt.Errorf("error deleting order: %w", err)
+		}
+		if n == 0 {
+			return orderVersionConflict(ctx, tx, id, version)
 		}
 
-		_, err = tx.ExecContext(ctx, "DELETE FROM order WHERE id=?", id)
+		_, err = tx.ExecContext(ctx, "UPDATE order_item SET deleted_at = now() WHERE order_id = $1 AND deleted_at IS NULL", id)
 		if err != nil {
-			return fmt.Errorf("error deleting order: %v", err)
+			return fmt.Errorf("error deleting order items: %w", err)
 		}
 
 		return nil
 	})
 
 	if err != nil {
-		return fmt.Errorf("error deleting order: %v", err)
+		return fmt.Errorf("error deleting order: %w", err)
 	}
 
 	return nil
 }
+
+// orderVersionConflict explains why a write on the order matched no row:
+// either the order is gone or it is at another version than expected.
+func orderVersionConflict(ctx context.Context, tx *sqlx.Tx, id int64, expected *int64) error {
+	if expected == nil {
+		return ErrOrderNotFound
+	}
+
+	var actual int64
+	err := tx.GetContext(ctx, &actual, `SELECT version FROM "order" WHERE id=$1 AND deleted_at IS NULL`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error checking order version: %w", err)
+	}
+
+	return &VersionConflictError{Resource: "order", ID: id, Expected: *expected, Actual: actual}
+}
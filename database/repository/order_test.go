@@ -1,42 +1,74 @@
 package repository
 
 import (
+	"chi-sqlx/apperror"
 	"chi-sqlx/database/entity"
 	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
 )
 
-func TestCreateOrder(t *testing.T) {
-	ois := []entity.OrderItem{
-		{
-			Name:      "test product",
-			Quantity:  1,
-			Image:     "test.png",
-			Price:     99.99,
-			ProductID: 1,
-		},
-		{
-			Name:      "test product 2",
-			Quantity:  2,
-			Image:     "test.png",
-			Price:     199.99,
-			ProductID: 2,
-		},
-	}
+const (
+	expectInsertOrder          = `INSERT INTO "order" (payment_method, tax_price, shipping_price, total_price) VALUES ($1, $2, $3, $4) RETURNING id, version, created_at, updated_at`
+	expectInsertOrderItem      = `INSERT INTO order_item (name, quantity, image, price, product_id, variant_id, order_id) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`
+	expectLockProducts         = `SELECT p.id, p.name, p.image, COALESCE(pp.price, p.price) AS price, p.count_in_stock FROM product p LEFT JOIN product_price pp ON pp.product_id = p.id AND pp.effective_from <= now() AND (pp.effective_to IS NULL OR pp.effective_to > now()) WHERE p.id = ANY($1) AND p.deleted_at IS NULL ORDER BY p.id FOR UPDATE OF p`
+	expectDecrementStock       = `UPDATE product SET count_in_stock = count_in_stock - $1, version = version + 1, updated_at = now() WHERE id = $2`
+	expectLockVariants         = `SELECT id, product_id, options, price, count_in_stock FROM product_variant WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id FOR UPDATE`
+	expectDecrementVariant     = `UPDATE product_variant SET count_in_stock = count_in_stock - $1, version = version + 1, updated_at = now() WHERE id = $2`
+	expectUpdateStatus         = `UPDATE "order" SET status = $1, version = version + 1, updated_at = now() WHERE id = $2 AND status = $3 RETURNING updated_at`
+	expectInsertHistory        = `INSERT INTO order_status_history (order_id, from_status, to_status, reason) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	expectSelectOrderItems     = `SELECT * FROM order_item WHERE order_id = ANY($1) ORDER BY order_id, id`
+	expectSelectOrderWithItems = `SELECT o.id, o.version, o.created_at, o.updated_at, o.deleted_at, o.status, o.payment_method, o.tax_price, o.shipping_price, o.total_price, oi.id AS item_id, oi.created_at AS item_created_at, oi.updated_at AS item_updated_at, oi.deleted_at AS item_deleted_at, oi.name AS item_name, oi.quantity AS item_quantity, oi.image AS item_image, oi.price AS item_price, oi.product_id AS item_product_id, oi.variant_id AS item_variant_id FROM "order" o LEFT JOIN order_item oi ON oi.order_id = o.id WHERE o.id = $1 AND o.deleted_at IS NULL ORDER BY oi.id`
+	expectListOrders           = `SELECT * FROM "order" WHERE deleted_at IS NULL ORDER BY created_at, id LIMIT $1`
+	expectRestoreStock         = `UPDATE product p SET count_in_stock = p.count_in_stock + oi.quantity, version = p.version + 1, updated_at = now() FROM ( SELECT product_id, SUM(quantity) AS quantity FROM order_item WHERE order_id = $1 AND variant_id IS NULL GROUP BY product_id ) oi WHERE p.id = oi.product_id`
+	expectInsertReturns        = `INSERT INTO stock_movement (product_id, variant_id, delta, reason, order_id) SELECT product_id, variant_id, SUM(quantity), 'return', order_id FROM order_item WHERE order_id = $1 GROUP BY product_id, variant_id, order_id`
+	expectRestoreVariantStock  = `UPDATE product_variant v SET count_in_stock = v.count_in_stock + oi.quantity, version = v.version + 1, updated_at = now() FROM ( SELECT variant_id, SUM(quantity) AS quantity FROM order_item WHERE order_id = $1 AND variant_id IS NOT NULL GROUP BY variant_id ) oi WHERE v.id = oi.variant_id`
+)
 
-	o := &entity.Order{
+// expectReserveItems mocks the product lookup and stock decrement for newTestOrder.
+func expectReserveItems(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(expectLockProducts).
+		WithArgs(pq.Array([]int64{1, 2})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "image", "price", "count_in_stock"}).
+			AddRow(1, "test product", "test.png", 100.0, 10).
+			AddRow(2, "test product 2", "test2.png", 50.0, 10))
+	mock.ExpectExec(expectDecrementStock).WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(expectDecrementStock).WithArgs(2, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func newTestOrder() *entity.Order {
+	return &entity.Order{
 		PaymentMethod: "test payment method",
 		TaxPrice:      10.0,
 		ShippingPrice: 20.0,
 		TotalPrice:    129.99,
-		Items:         ois,
+		Items: []entity.OrderItem{
+			{
+				Name:      "test product",
+				Quantity:  1,
+				Image:     "test.png",
+				Price:     99.99,
+				ProductID: 1,
+			},
+			{
+				Name:      "test product 2",
+				Quantity:  2,
+				Image:     "test.png",
+				Price:     199.99,
+				ProductID: 2,
+			},
+		},
 	}
+}
 
+func TestCreateOrder(t *testing.T) {
 	tcs := []struct {
 		name string
 		test func(*testing.T, *OrderRepository, sqlmock.Sqlmock)
@@ -44,15 +76,188 @@ func TestCreateOrder(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				o := newTestOrder()
+				now := time.Now()
+
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO order (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_item (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_item (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(2, 1))
+				expectReserveItems(mock)
+				// subtotal 100*1 + 50*2 = 200, tax 22, shipping 20
+				mock.ExpectQuery(expectInsertOrder).
+					WithArgs(o.PaymentMethod, 22.0, 20.0, 242.0).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at"}).AddRow(1, 1, now, now))
+				mock.ExpectExec(expectInsertMovements(2)).
+					WithArgs(int64(1), nil, int64(-1), "sale", int64(1), "", int64(2), nil, int64(-2), "sale", int64(1), "").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectQuery(expectInsertOrderItem).
+					WithArgs("test product", int64(1), "test.png", 100.0, int64(1), nil, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(10, now, now))
+				mock.ExpectQuery(expectInsertOrderItem).
+					WithArgs("test product 2", int64(2), "test2.png", 50.0, int64(2), nil, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(11, now, now))
 				mock.ExpectCommit()
 
 				co, err := repo.CreateOrder(context.Background(), o)
 				require.NoError(t, err)
 				require.Equal(t, int64(1), co.ID)
+				require.Equal(t, 22.0, co.TaxPrice)
+				require.Equal(t, 242.0, co.TotalPrice)
+				require.Equal(t, 100.0, co.Items[0].Price)
+				require.Equal(t, "test2.png", co.Items[1].Image)
+				require.Equal(t, now, co.CreatedAt)
+				require.Len(t, co.Items, 2)
+				require.Equal(t, int64(10), co.Items[0].ID)
+				require.Equal(t, int64(11), co.Items[1].ID)
+				for _, oi := range co.Items {
+					require.Equal(t, int64(1), oi.OrderID)
+					require.Equal(t, now, oi.CreatedAt)
+				}
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "out of stock",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				o := newTestOrder()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockProducts).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "image", "price", "count_in_stock"}).
+						AddRow(1, "test product", "test.png", 100.0, 10).
+						AddRow(2, "test product 2", "test2.png", 50.0, 1))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateOrder(context.Background(), o)
+				var outOfStock *OutOfStockError
+				require.True(t, errors.As(err, &outOfStock))
+				require.Equal(t, int64(2), outOfStock.ProductID)
+				require.Equal(t, int64(2), outOfStock.Requested)
+				require.Equal(t, int64(1), outOfStock.Available)
+				require.ErrorIs(t, err, apperror.ErrOutOfStock)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown product",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				o := newTestOrder()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockProducts).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "image", "price", "count_in_stock"}).
+						AddRow(1, "test product", "test.png", 100.0, 10))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateOrder(context.Background(), o)
+				require.ErrorIs(t, err, ErrProductNotFound)
+				require.ErrorIs(t, err, apperror.ErrValidation)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "variant",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				variantID := int64(7)
+				o := newTestOrder()
+				o.Items[1].VariantID = &variantID
+				now := time.Now()
+
+				mock.ExpectBegin()
+				// product 2 is only locked for its name, its stock is not touched
+				mock.ExpectQuery(expectLockProducts).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "image", "price", "count_in_stock"}).
+						AddRow(1, "test product", "test.png", 100.0, 10).
+						AddRow(2, "test product 2", "test2.png", 50.0, 0))
+				mock.ExpectQuery(expectLockVariants).
+					WithArgs(pq.Array([]int64{7})).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "options", "price", "count_in_stock"}).
+						AddRow(7, 2, []byte(`{"size":"M","color":"red"}`), 60.0, 5))
+				mock.ExpectExec(expectDecrementStock).WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(expectDecrementVariant).WithArgs(2, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				// subtotal 100*1 + 60*2 = 220, tax 24.2, shipping 20
+				mock.ExpectQuery(expectInsertOrder).
+					WithArgs(o.PaymentMethod, 24.2, 20.0, 264.2).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at"}).AddRow(1, 1, now, now))
+				mock.ExpectExec(expectInsertMovements(2)).
+					WithArgs(int64(1), nil, int64(-1), "sale", int64(1), "", int64(2), int64(7), int64(-2), "sale", int64(1), "").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectQuery(expectInsertOrderItem).
+					WithArgs("test product", int64(1), "test.png", 100.0, int64(1), nil, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(10, now, now))
+				mock.ExpectQuery(expectInsertOrderItem).
+					WithArgs("test product 2 (red, M)", int64(2), "test2.png", 60.0, int64(2), int64(7), 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(11, now, now))
+				mock.ExpectCommit()
+
+				co, err := repo.CreateOrder(context.Background(), o)
+				require.NoError(t, err)
+				require.Equal(t, 264.2, co.TotalPrice)
+				require.Equal(t, "test product 2 (red, M)", co.Items[1].Name)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "variant out of stock",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				variantID := int64(7)
+				o := newTestOrder()
+				o.Items[1].VariantID = &variantID
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockProducts).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "image", "price", "count_in_stock"}).
+						AddRow(1, "test product", "test.png", 100.0, 10).
+						AddRow(2, "test product 2", "test2.png", 50.0, 10))
+				mock.ExpectQuery(expectLockVariants).
+					WithArgs(pq.Array([]int64{7})).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "options", "price", "count_in_stock"}).
+						AddRow(7, 2, []byte(`{"size":"M"}`), nil, 1))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateOrder(context.Background(), o)
+				var outOfStock *OutOfStockError
+				require.True(t, errors.As(err, &outOfStock))
+				require.Equal(t, int64(2), outOfStock.ProductID)
+				require.Equal(t, &variantID, outOfStock.VariantID)
+				require.Equal(t, int64(1), outOfStock.Available)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "variant of another product",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				variantID := int64(7)
+				o := newTestOrder()
+				o.Items[0].VariantID = &variantID
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockProducts).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "image", "price", "count_in_stock"}).
+						AddRow(1, "test product", "test.png", 100.0, 10).
+						AddRow(2, "test product 2", "test2.png", 50.0, 10))
+				mock.ExpectQuery(expectLockVariants).
+					WithArgs(pq.Array([]int64{7})).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "options", "price", "count_in_stock"}).
+						AddRow(7, 2, []byte(`{}`), nil, 5))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateOrder(context.Background(), o)
+				require.ErrorIs(t, err, ErrVariantNotFound)
+				require.ErrorIs(t, err, apperror.ErrValidation)
 
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
@@ -61,8 +266,11 @@ func TestCreateOrder(t *testing.T) {
 		{
 			name: "failed creating order",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				o := newTestOrder()
+
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO order (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnError(fmt.Errorf("error creating order"))
+				expectReserveItems(mock)
+				mock.ExpectQuery(expectInsertOrder).WillReturnError(fmt.Errorf("error creating order"))
 				mock.ExpectRollback()
 
 				_, err := repo.CreateOrder(context.Background(), o)
@@ -75,9 +283,15 @@ func TestCreateOrder(t *testing.T) {
 		{
 			name: "failed creating order item",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				o := newTestOrder()
+				now := time.Now()
+
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO order (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_item (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnError(fmt.Errorf("error creating order item"))
+				expectReserveItems(mock)
+				mock.ExpectQuery(expectInsertOrder).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at"}).AddRow(1, 1, now, now))
+				mock.ExpectExec(expectInsertMovements(2)).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectQuery(expectInsertOrderItem).WillReturnError(fmt.Errorf("error creating order item"))
 				mock.ExpectRollback()
 
 				_, err := repo.CreateOrder(context.Background(), o)
@@ -90,10 +304,18 @@ func TestCreateOrder(t *testing.T) {
 		{
 			name: "failed committing transaction",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				o := newTestOrder()
+				now := time.Now()
+
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO order (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_item (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_item (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(2, 1))
+				expectReserveItems(mock)
+				mock.ExpectQuery(expectInsertOrder).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at"}).AddRow(1, 1, now, now))
+				mock.ExpectExec(expectInsertMovements(2)).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectQuery(expectInsertOrderItem).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(10, now, now))
+				mock.ExpectQuery(expectInsertOrderItem).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(11, now, now))
 				mock.ExpectCommit().WillReturnError(fmt.Errorf("error committing transaction"))
 
 				_, err := repo.CreateOrder(context.Background(), o)
@@ -116,30 +338,8 @@ func TestCreateOrder(t *testing.T) {
 }
 
 func TestGetOrder(t *testing.T) {
-	ois := []entity.OrderItem{
-		{
-			Name:      "test product",
-			Quantity:  1,
-			Image:     "test.png",
-			Price:     99.99,
-			ProductID: 1,
-		},
-		{
-			Name:      "test product 2",
-			Quantity:  2,
-			Image:     "test.png",
-			Price:     199.99,
-			ProductID: 2,
-		},
-	}
-
-	o := &entity.Order{
-		PaymentMethod: "test payment method",
-		TaxPrice:      10.0,
-		ShippingPrice: 20.0,
-		TotalPrice:    129.99,
-		Items:         ois,
-	}
+	o := newTestOrder()
+	ois := o.Items
 
 	tcs := []struct {
 		name string
@@ -151,17 +351,18 @@ func TestGetOrder(t *testing.T) {
 				orows := sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at", "deleted_at"}).
 					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt, o.DeletedAt)
 
-				mock.ExpectQuery("SELECT * FROM order WHERE id=?").WithArgs(1).WillReturnRows(orows)
+				mock.ExpectQuery(`SELECT * FROM "order" WHERE id=$1 AND deleted_at IS NULL`).WithArgs(1).WillReturnRows(orows)
 
 				oirows := sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}).
-					AddRow(1, ois[0].Name, ois[0].Quantity, ois[0].Image, ois[0].Price, ois[0].ProductID, ois[0].OrderID).
-					AddRow(2, ois[1].Name, ois[1].Quantity, ois[1].Image, ois[1].Price, ois[1].ProductID, ois[1].OrderID)
+					AddRow(1, ois[0].Name, ois[0].Quantity, ois[0].Image, ois[0].Price, ois[0].ProductID, 1).
+					AddRow(2, ois[1].Name, ois[1].Quantity, ois[1].Image, ois[1].Price, ois[1].ProductID, 1)
 
-				mock.ExpectQuery("SELECT * FROM order_item WHERE order_id=?").WithArgs(1).WillReturnRows(oirows)
+				mock.ExpectQuery("SELECT * FROM order_item WHERE order_id=$1").WithArgs(1).WillReturnRows(oirows)
 
 				mo, err := repo.GetOrder(context.Background(), 1)
 				require.NoError(t, err)
 				require.Equal(t, int64(1), mo.ID)
+				require.Len(t, mo.Items, 2)
 
 				for i, oi := range mo.Items {
 					require.Equal(t, ois[i].Name, oi.Name)
@@ -178,7 +379,7 @@ func TestGetOrder(t *testing.T) {
 		{
 			name: "failed getting order",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT * FROM order WHERE id=?").WithArgs(1).WillReturnError(fmt.Errorf("error getting order"))
+				mock.ExpectQuery(`SELECT * FROM "order" WHERE id=$1 AND deleted_at IS NULL`).WithArgs(1).WillReturnError(fmt.Errorf("error getting order"))
 
 				_, err := repo.GetOrder(context.Background(), 1)
 				require.Error(t, err)
@@ -193,9 +394,9 @@ func TestGetOrder(t *testing.T) {
 				orows := sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at", "deleted_at"}).
 					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt, o.DeletedAt)
 
-				mock.ExpectQuery("SELECT * FROM order WHERE id=?").WithArgs(1).WillReturnRows(orows)
+				mock.ExpectQuery(`SELECT * FROM "order" WHERE id=$1 AND deleted_at IS NULL`).WithArgs(1).WillReturnRows(orows)
 
-				mock.ExpectQuery("SELECT * FROM order_item WHERE order_id=?").WithArgs(1).WillReturnError(fmt.Errorf("error getting order item"))
+				mock.ExpectQuery("SELECT * FROM order_item WHERE order_id=$1").WithArgs(1).WillReturnError(fmt.Errorf("error getting order item"))
 
 				_, err := repo.GetOrder(context.Background(), 1)
 				require.Error(t, err)
@@ -216,31 +417,85 @@ func TestGetOrder(t *testing.T) {
 	}
 }
 
-func TestListOrders(t *testing.T) {
-	ois := []entity.OrderItem{
+func TestGetOrderWithItems(t *testing.T) {
+	o := newTestOrder()
+	ois := o.Items
+	cols := []string{"id", "version", "created_at", "updated_at", "deleted_at", "status", "payment_method", "tax_price", "shipping_price", "total_price",
+		"item_id", "item_created_at", "item_updated_at", "item_deleted_at", "item_name", "item_quantity", "item_image", "item_price", "item_product_id"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *OrderRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				rows := sqlmock.NewRows(cols).
+					AddRow(1, 1, now, now, nil, "pending", o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice,
+						10, now, now, nil, ois[0].Name, ois[0].Quantity, ois[0].Image, ois[0].Price, ois[0].ProductID).
+					AddRow(1, 1, now, now, nil, "pending", o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice,
+						11, now, now, nil, ois[1].Name, ois[1].Quantity, ois[1].Image, ois[1].Price, ois[1].ProductID)
+				mock.ExpectQuery(expectSelectOrderWithItems).WithArgs(1).WillReturnRows(rows)
+
+				mo, err := repo.GetOrderWithItems(context.Background(), 1)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), mo.ID)
+				require.Equal(t, entity.OrderStatusPending, mo.Status)
+				require.Len(t, mo.Items, 2)
+				require.Equal(t, int64(10), mo.Items[0].ID)
+				require.Equal(t, ois[1].Name, mo.Items[1].Name)
+				require.Equal(t, int64(1), mo.Items[1].OrderID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
 		{
-			Name:      "test product",
-			Quantity:  1,
-			Image:     "test.png",
-			Price:     99.99,
-			ProductID: 1,
+			name: "order without items",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				rows := sqlmock.NewRows(cols).
+					AddRow(1, 1, now, now, nil, "pending", o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice,
+						nil, nil, nil, nil, nil, nil, nil, nil, nil)
+				mock.ExpectQuery(expectSelectOrderWithItems).WithArgs(1).WillReturnRows(rows)
+
+				mo, err := repo.GetOrderWithItems(context.Background(), 1)
+				require.NoError(t, err)
+				require.Empty(t, mo.Items)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
 		},
 		{
-			Name:      "test product 2",
-			Quantity:  2,
-			Image:     "test.png",
-			Price:     199.99,
-			ProductID: 2,
+			name: "order not found",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(expectSelectOrderWithItems).WithArgs(1).WillReturnRows(sqlmock.NewRows(cols))
+
+				_, err := repo.GetOrderWithItems(context.Background(), 1)
+				require.ErrorIs(t, err, ErrOrderNotFound)
+				require.ErrorIs(t, err, apperror.ErrNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
 		},
 	}
 
-	o := &entity.Order{
-		PaymentMethod: "test payment method",
-		TaxPrice:      10.0,
-		ShippingPrice: 20.0,
-		TotalPrice:    129.99,
-		Items:         ois,
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewOrderRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
 	}
+}
+
+func TestListOrders(t *testing.T) {
+	o := newTestOrder()
+	ois := o.Items
 
 	tcs := []struct {
 		name string
@@ -250,19 +505,51 @@ func TestListOrders(t *testing.T) {
 			name: "success",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
 				orows := sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at", "deleted_at"}).
-					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt, o.DeletedAt)
+					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt, o.DeletedAt).
+					AddRow(2, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt, o.DeletedAt).
+					AddRow(3, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt, o.DeletedAt)
 
-				mock.ExpectQuery("SELECT * FROM order").WillReturnRows(orows)
+				mock.ExpectQuery(expectListOrders).WillReturnRows(orows)
 
 				oirows := sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}).
-					AddRow(1, ois[0].Name, ois[0].Quantity, ois[0].Image, ois[0].Price, ois[0].ProductID, ois[0].OrderID).
-					AddRow(2, ois[1].Name, ois[1].Quantity, ois[1].Image, ois[1].Price, ois[1].ProductID, ois[1].OrderID)
+					AddRow(1, ois[0].Name, ois[0].Quantity, ois[0].Image, ois[0].Price, ois[0].ProductID, 1).
+					AddRow(2, ois[1].Name, ois[1].Quantity, ois[1].Image, ois[1].Price, ois[1].ProductID, 1).
+					AddRow(3, ois[0].Name, ois[0].Quantity, ois[0].Image, ois[0].Price, ois[0].ProductID, 3)
+
+				mock.ExpectQuery(expectSelectOrderItems).WithArgs(pq.Array([]int64{1, 2, 3})).WillReturnRows(oirows)
+
+				mo, err := repo.ListOrders(context.Background(), entity.OrderFilter{}, entity.Pagination{})
+				require.NoError(t, err)
+				require.Len(t, mo.Items, 3)
+				require.Len(t, mo.Items[0].Items, 2)
+				require.Empty(t, mo.Items[1].Items)
+				require.Len(t, mo.Items[2].Items, 1)
+				require.Equal(t, int64(3), mo.Items[2].Items[0].ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "include deleted",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT * FROM "order" ORDER BY created_at, id LIMIT $1`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
-				mock.ExpectQuery("SELECT * FROM order_item WHERE order_id=?").WithArgs(1).WillReturnRows(oirows)
+				_, err := repo.ListOrders(context.Background(), entity.OrderFilter{IncludeDeleted: true}, entity.Pagination{})
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "no orders",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(expectListOrders).WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
-				mo, err := repo.ListOrders(context.Background())
+				mo, err := repo.ListOrders(context.Background(), entity.OrderFilter{}, entity.Pagination{})
 				require.NoError(t, err)
-				require.Len(t, mo, 1)
+				require.Empty(t, mo.Items)
 
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
@@ -271,9 +558,9 @@ func TestListOrders(t *testing.T) {
 		{
 			name: "failed getting order",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT * FROM order").WillReturnError(fmt.Errorf("error querying order"))
+				mock.ExpectQuery(expectListOrders).WillReturnError(fmt.Errorf("error querying order"))
 
-				_, err := repo.ListOrders(context.Background())
+				_, err := repo.ListOrders(context.Background(), entity.OrderFilter{}, entity.Pagination{})
 				require.Error(t, err)
 
 				err = mock.ExpectationsWereMet()
@@ -286,11 +573,204 @@ func TestListOrders(t *testing.T) {
 				orows := sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at", "deleted_at"}).
 					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt, o.DeletedAt)
 
-				mock.ExpectQuery("SELECT * FROM order").WillReturnRows(orows)
+				mock.ExpectQuery(expectListOrders).WillReturnRows(orows)
 
-				mock.ExpectQuery("SELECT * FROM order_item WHERE order_id=?").WithArgs(1).WillReturnError(fmt.Errorf("error querying order item"))
+				mock.ExpectQuery(expectSelectOrderItems).WithArgs(pq.Array([]int64{1})).WillReturnError(fmt.Errorf("error querying order item"))
 
-				_, err := repo.ListOrders(context.Background())
+				_, err := repo.ListOrders(context.Background(), entity.OrderFilter{}, entity.Pagination{})
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewOrderRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+// BenchmarkListOrders shows that ListOrders issues the same number of queries
+// no matter how many orders are returned.
+func BenchmarkListOrders(b *testing.B) {
+	for _, n := range []int{10, 50, MaxPageLimit} {
+		b.Run(fmt.Sprintf("orders=%d", n), func(b *testing.B) {
+			var queries int
+			matcher := sqlmock.QueryMatcherFunc(func(expectedSQL, actualSQL string) error {
+				queries++
+				return sqlmock.QueryMatcherEqual.Match(expectedSQL, actualSQL)
+			})
+
+			mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+			require.NoError(b, err)
+			defer mockDB.Close()
+
+			repo := NewOrderRepository(sqlx.NewDb(mockDB, "sqlmock"))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				orows := sqlmock.NewRows([]string{"id", "payment_method", "total_price"})
+				oirows := sqlmock.NewRows([]string{"id", "order_id", "name", "quantity", "price", "product_id"})
+				for id := 1; id <= n; id++ {
+					orows.AddRow(id, "card", 10.0)
+					oirows.AddRow(id*2, id, "item", 1, 5.0, 1)
+					oirows.AddRow(id*2+1, id, "item", 1, 5.0, 2)
+				}
+				mock.ExpectQuery(expectListOrders).WillReturnRows(orows)
+				mock.ExpectQuery(expectSelectOrderItems).WillReturnRows(oirows)
+				b.StartTimer()
+
+				orders, err := repo.ListOrders(context.Background(), entity.OrderFilter{}, entity.Pagination{Limit: n})
+				require.NoError(b, err)
+				require.Len(b, orders.Items, n)
+			}
+			b.StopTimer()
+
+			require.NoError(b, mock.ExpectationsWereMet())
+			b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+		})
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	const pending, paid = entity.OrderStatusPending, entity.OrderStatusPaid
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *OrderRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateStatus).WithArgs(paid, 1, pending).
+					WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+				mock.ExpectQuery(expectInsertHistory).WithArgs(1, pending, paid, "payment received").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, now))
+				mock.ExpectCommit()
+
+				h, err := repo.UpdateOrderStatus(context.Background(), 1, pending, paid, "payment received")
+				require.NoError(t, err)
+				require.Equal(t, int64(5), h.ID)
+				require.Equal(t, paid, h.ToStatus)
+				require.Equal(t, now, h.CreatedAt)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "status changed concurrently",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateStatus).WithArgs(paid, 1, pending).
+					WillReturnRows(sqlmock.NewRows([]string{"updated_at"}))
+				mock.ExpectRollback()
+
+				_, err := repo.UpdateOrderStatus(context.Background(), 1, pending, paid, "")
+				require.ErrorIs(t, err, ErrOrderStatusChanged)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed inserting history",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateStatus).WithArgs(paid, 1, pending).
+					WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+				mock.ExpectQuery(expectInsertHistory).WillReturnError(fmt.Errorf("error inserting history"))
+				mock.ExpectRollback()
+
+				_, err := repo.UpdateOrderStatus(context.Background(), 1, pending, paid, "")
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewOrderRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	const paid, cancelled = entity.OrderStatusPaid, entity.OrderStatusCancelled
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *OrderRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateStatus).WithArgs(cancelled, 1, paid).
+					WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+				mock.ExpectQuery(expectInsertHistory).WithArgs(1, paid, cancelled, "customer request").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, now))
+				mock.ExpectExec(expectRestoreStock).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(expectRestoreVariantStock).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(expectInsertReturns).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				h, err := repo.CancelOrder(context.Background(), 1, paid, "customer request")
+				require.NoError(t, err)
+				require.Equal(t, cancelled, h.ToStatus)
+				require.Equal(t, "customer request", h.Reason)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "already cancelled",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateStatus).WithArgs(cancelled, 1, paid).
+					WillReturnRows(sqlmock.NewRows([]string{"updated_at"}))
+				mock.ExpectRollback()
+
+				_, err := repo.CancelOrder(context.Background(), 1, paid, "")
+				require.ErrorIs(t, err, ErrOrderStatusChanged)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed restoring stock",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateStatus).WithArgs(cancelled, 1, paid).
+					WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+				mock.ExpectQuery(expectInsertHistory).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, now))
+				mock.ExpectExec(expectRestoreStock).WithArgs(1).WillReturnError(fmt.Errorf("error restoring stock"))
+				mock.ExpectRollback()
+
+				_, err := repo.CancelOrder(context.Background(), 1, paid, "")
 				require.Error(t, err)
 
 				err = mock.ExpectationsWereMet()
@@ -310,6 +790,12 @@ func TestListOrders(t *testing.T) {
 }
 
 func TestDeleteOrder(t *testing.T) {
+	const (
+		expectDeleteOrder          = `UPDATE "order" SET deleted_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL`
+		expectDeleteOrderIfVersion = `UPDATE "order" SET deleted_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL AND version = $2`
+		expectDeleteOrderItems     = `UPDATE order_item SET deleted_at = now() WHERE order_id = $1 AND deleted_at IS NULL`
+	)
+
 	tcs := []struct {
 		name string
 		test func(*testing.T, *OrderRepository, sqlmock.Sqlmock)
@@ -318,8 +804,8 @@ func TestDeleteOrder(t *testing.T) {
 			name: "success",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("DELETE FROM order_item WHERE order_id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("DELETE FROM order WHERE id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(expectDeleteOrder).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(expectDeleteOrderItems).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
 				mock.ExpectCommit()
 
 				err := repo.DeleteOrder(context.Background(), 1)
@@ -330,14 +816,48 @@ func TestDeleteOrder(t *testing.T) {
 			},
 		},
 		{
-			name: "failed deleting order item",
+			name: "order not found",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("DELETE FROM order_item WHERE order_id=?").WithArgs(1).WillReturnError(fmt.Errorf("error deleting order item"))
+				mock.ExpectExec(expectDeleteOrder).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
 				mock.ExpectRollback()
 
 				err := repo.DeleteOrder(context.Background(), 1)
-				require.Error(t, err)
+				require.ErrorIs(t, err, ErrOrderNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "version matches",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(expectDeleteOrderIfVersion).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(expectDeleteOrderItems).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				err := repo.DeleteOrderIfVersion(context.Background(), 1, 3)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "version conflict",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(expectDeleteOrderIfVersion).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT version FROM "order" WHERE id=$1 AND deleted_at IS NULL`).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+				mock.ExpectRollback()
+
+				err := repo.DeleteOrderIfVersion(context.Background(), 1, 3)
+				var conflict *VersionConflictError
+				require.ErrorAs(t, err, &conflict)
+				require.Equal(t, int64(3), conflict.Expected)
+				require.Equal(t, int64(4), conflict.Actual)
 
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
@@ -347,8 +867,22 @@ func TestDeleteOrder(t *testing.T) {
 			name: "failed deleting order",
 			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("DELETE FROM order_item WHERE order_id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("DELETE FROM order WHERE id=?").WithArgs(1).WillReturnError(fmt.Errorf("error deleting order"))
+				mock.ExpectExec(expectDeleteOrder).WithArgs(1).WillReturnError(fmt.Errorf("error deleting order"))
+				mock.ExpectRollback()
+
+				err := repo.DeleteOrder(context.Background(), 1)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed deleting order items",
+			test: func(t *testing.T, repo *OrderRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(expectDeleteOrder).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(expectDeleteOrderItems).WithArgs(1).WillReturnError(fmt.Errorf("error deleting order item"))
 				mock.ExpectRollback()
 
 				err := repo.DeleteOrder(context.Background(), 1)
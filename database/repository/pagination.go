@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var (
+	ErrInvalidSort       = errors.New("invalid sort field")
+	ErrCursorSort  error = apperror.Validation("cursor_sort", "cursor pagination is only supported with the default sort",
+		apperror.FieldError{Field: "cursor", Message: "cannot be combined with sort"})
+)
+
+// whereClause collects SQL conditions written with "?" placeholders. Queries
+// are rebound to PostgreSQL "$n" placeholders once fully assembled.
+type whereClause struct {
+	conds []string
+	args  []interface{}
+}
+
+func (w *whereClause) add(cond string, args ...interface{}) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+func (w *whereClause) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+
+	return limit
+}
+
+// orderByClause maps the requested sort fields onto whitelisted columns. The
+// id column is always appended so that the order is stable between pages. An
+// empty result means the default (created_at, id) keyset order.
+func orderByClause(sort []entity.SortField, columns map[string]string) (string, error) {
+	if len(sort) == 0 {
+		return "", nil
+	}
+
+	terms := make([]string, 0, len(sort)+1)
+	for _, sf := range sort {
+		column, ok := columns[sf.Field]
+		if !ok {
+			return "", &apperror.Error{
+				Kind:    apperror.ErrValidation,
+				Code:    "invalid_sort",
+				Message: fmt.Sprintf("%s: %s", ErrInvalidSort, sf.Field),
+				Fields:  []apperror.FieldError{{Field: "sort", Message: fmt.Sprintf("cannot sort by %q", sf.Field)}},
+				Err:     ErrInvalidSort,
+			}
+		}
+
+		if sf.Desc {
+			terms = append(terms, column+" DESC")
+		} else {
+			terms = append(terms, column+" ASC")
+		}
+	}
+
+	return strings.Join(append(terms, "id ASC"), ", "), nil
+}
+
+// paginate selects one page of rows from table. With an empty orderBy rows come
+// in (created_at, id) order and may be paged by cursor, otherwise only offset
+// paging is possible. One row more than the limit is fetched to find out
+// whether a next page exists.
+func paginate[T any](ctx context.Context, db *sqlx.DB, table string, where whereClause, orderBy string, page entity.Pagination, cursorOf func(T) entity.Cursor) (*entity.Page[T], error) {
+	limit := normalizeLimit(page.Limit)
+	result := &entity.Page[T]{Items: []T{}}
+
+	keyset := orderBy == ""
+	if !keyset && page.Cursor != nil {
+		return nil, ErrCursorSort
+	}
+	if keyset {
+		orderBy = "created_at, id"
+	}
+
+	if page.WithTotal {
+		var total int64
+		err := db.GetContext(ctx, &total, sqlx.Rebind(sqlx.DOLLAR, "SELECT count(*) FROM "+table+where.String()), where.args...)
+		if err != nil {
+			return nil, fmt.Errorf("error counting rows: %w", err)
+		}
+		result.Total = &total
+	}
+
+	if page.Cursor != nil {
+		where.add("(created_at, id) > (?, ?)", page.Cursor.CreatedAt, page.Cursor.ID)
+	}
+
+	query := "SELECT * FROM " + table + where.String() + " ORDER BY " + orderBy + " LIMIT ?"
+	args := append(where.args, limit+1)
+	if page.Cursor == nil && page.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, page.Offset)
+	}
+
+	err := db.SelectContext(ctx, &result.Items, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) > limit {
+		result.Items = result.Items[:limit]
+		if keyset {
+			next := cursorOf(result.Items[limit-1])
+			result.NextCursor = &next
+		}
+	}
+
+	return result, nil
+}
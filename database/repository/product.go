@@ -1,14 +1,19 @@
 package repository
 
 import (
+	"chi-sqlx/apperror"
 	"chi-sqlx/database/entity"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
+var ErrProductNotFound error = apperror.NotFound("product_not_found", "product not found")
+
 type ProductRepository struct {
 	db *sqlx.DB
 }
@@ -20,32 +25,47 @@ func NewProductRepository(db *sqlx.DB) *ProductRepository {
 }
 
 const insertProduct = `
-	INSERT INTO product (name, image, category, description, rating, num_reviews, price, count_in_stock) 
+	INSERT INTO product (name, image, category, description, price, count_in_stock, category_id, reorder_threshold)
 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	RETURNING id, created_at, updated_at
+	RETURNING id, version, created_at, updated_at
 `
 
+// CreateProduct inserts the product, records its initial stock in the stock
+// ledger and starts its price history.
 func (repo *ProductRepository) CreateProduct(ctx context.Context, p *entity.Product) (*entity.Product, error) {
 	var lastInsertID int64
+	var version int64
 	var createdAt time.Time
 	var updatedAt time.Time
 
-	err := repo.db.QueryRowContext(ctx, insertProduct,
-		p.Name,
-		p.Image,
-		p.Category,
-		p.Description,
-		p.Rating,
-		p.NumReviews,
-		p.Price,
-		p.CountInStock).
-		Scan(&lastInsertID, &createdAt, &updatedAt)
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowContext(ctx, insertProduct,
+			p.Name,
+			p.Image,
+			p.Category,
+			p.Description,
+			p.Price,
+			p.CountInStock,
+			p.CategoryID,
+			p.ReorderThreshold).
+			Scan(&lastInsertID, &version, &createdAt, &updatedAt)
+		if err != nil {
+			return err
+		}
+
+		if err := insertProductPrices(ctx, tx, []int64{lastInsertID}); err != nil {
+			return err
+		}
+
+		return recordStockMovements(ctx, tx, initialStock(lastInsertID, nil, p.CountInStock))
+	})
 
 	if err != nil {
 		return nil, fmt.Errorf("error inserting product: %w", err)
 	}
 
 	p.ID = lastInsertID
+	p.Version = version
 	p.CreatedAt = createdAt
 	p.UpdatedAt = updatedAt
 
@@ -55,39 +75,261 @@ func (repo *ProductRepository) CreateProduct(ctx context.Context, p *entity.Prod
 func (repo *ProductRepository) GetProduct(ctx context.Context, id int64) (*entity.Product, error) {
 	var p entity.Product
 
+	err := repo.db.GetContext(ctx, &p, "SELECT * FROM product WHERE id=$1 AND deleted_at IS NULL", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error getting product: %w", ErrProductNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting product: %w", err)
+	}
+
+	return &p, nil
+}
+
+// GetProductWithDeleted is like GetProduct but also finds soft deleted products.
+func (repo *ProductRepository) GetProductWithDeleted(ctx context.Context, id int64) (*entity.Product, error) {
+	var p entity.Product
+
 	err := repo.db.GetContext(ctx, &p, "SELECT * FROM product WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error getting product: %w", ErrProductNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error getting product: %v", err)
+		return nil, fmt.Errorf("error getting product: %w", err)
 	}
 
 	return &p, nil
 }
 
-func (repo *ProductRepository) ListProducts(ctx context.Context) ([]entity.Product, error) {
-	var products []entity.Product
+// productSortColumns whitelists the fields a product listing can be sorted by.
+var productSortColumns = map[string]string{
+	"name":        "name",
+	"price":       "price",
+	"rating":      "rating",
+	"num_reviews": "num_reviews",
+	"created_at":  "created_at",
+	"updated_at":  "updated_at",
+}
+
+func productWhere(f entity.ProductFilter) whereClause {
+	var where whereClause
+	if !f.IncludeDeleted {
+		where.add("deleted_at IS NULL")
+	}
+	if f.CategoryID != nil && f.IncludeDescendants {
+		where.add("category_id IN ("+selectCategorySubtree+")", *f.CategoryID)
+	} else if f.CategoryID != nil {
+		where.add("category_id = ?", *f.CategoryID)
+	}
+	if f.Category != "" && f.IncludeDescendants {
+		where.add("category_id IN ("+selectNamedCategorySubtree+")", f.Category, f.Category)
+	} else if f.Category != "" {
+		where.add("category_id IN ("+selectNamedCategories+")", f.Category, f.Category)
+	}
+	if f.MinPrice != nil {
+		where.add("price >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		where.add("price <= ?", *f.MaxPrice)
+	}
+	if f.MinRating != nil {
+		where.add("rating >= ?", *f.MinRating)
+	}
+	if f.InStock {
+		where.add("count_in_stock > 0")
+	}
+	if f.CreatedAfter != nil {
+		where.add("created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		where.add("created_at < ?", *f.CreatedBefore)
+	}
+
+	return where
+}
+
+func (repo *ProductRepository) ListProducts(ctx context.Context, filter entity.ProductFilter, page entity.Pagination) (*entity.Page[entity.Product], error) {
+	orderBy, err := orderByClause(filter.Sort, productSortColumns)
+	if err != nil {
+		return nil, err
+	}
 
-	err := repo.db.SelectContext(ctx, &products, "SELECT * FROM product")
+	products, err := paginate(ctx, repo.db, "product", productWhere(filter), orderBy, page, productCursor)
 	if err != nil {
-		return nil, fmt.Errorf("error listing products: %v", err)
+		return nil, fmt.Errorf("error listing products: %w", err)
 	}
 
 	return products, nil
 }
 
+func productCursor(p entity.Product) entity.Cursor {
+	return entity.Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+}
+
+// productSearchDocument must stay identical to the expression indexed by
+// product_search_idx, otherwise PostgreSQL cannot use the GIN index.
+const productSearchDocument = `(
+	setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(category, '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(description, '')), 'C')
+)`
+
+// productSearchHeadline highlights the matches in name and description. The
+// text is HTML-escaped before it is highlighted, so that the <mark> tags are
+// the only markup in the headline.
+const productSearchHeadline = `ts_headline('english',
+	replace(replace(replace(name || ' ' || coalesce(description, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+	query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')`
+
+const searchProducts = `
+	SELECT product.*,
+		ts_rank(` + productSearchDocument + `, query) AS rank,
+		` + productSearchHeadline + ` AS headline
+	FROM product, websearch_to_tsquery('english', $1) query
+	WHERE ` + productSearchDocument + ` @@ query AND deleted_at IS NULL
+	ORDER BY rank DESC, id
+	LIMIT $2 OFFSET $3
+`
+
+const countSearchProducts = `
+	SELECT count(*)
+	FROM product, websearch_to_tsquery('english', $1) query
+	WHERE ` + productSearchDocument + ` @@ query AND deleted_at IS NULL
+`
+
+// SearchProducts runs a full-text search over name, category and description,
+// best matches first. Only limit/offset paging is supported.
+func (repo *ProductRepository) SearchProducts(ctx context.Context, q string, page entity.Pagination) (*entity.Page[entity.ProductSearchResult], error) {
+	limit := normalizeLimit(page.Limit)
+	result := &entity.Page[entity.ProductSearchResult]{Items: []entity.ProductSearchResult{}}
+
+	if page.WithTotal {
+		var total int64
+		err := repo.db.GetContext(ctx, &total, countSearchProducts, q)
+		if err != nil {
+			return nil, fmt.Errorf("error counting products: %w", err)
+		}
+		result.Total = &total
+	}
+
+	err := repo.db.SelectContext(ctx, &result.Items, searchProducts, q, limit, page.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("error searching products: %w", err)
+	}
+
+	return result, nil
+}
+
+// count_in_stock is only changed through the stock ledger, the update returns
+// the current count.
+const updateProduct = `
+	UPDATE product
+	SET name = $3, image = $4, category = $5, description = $6, price = $7,
+		category_id = $8, reorder_threshold = $9, version = version + 1, updated_at = now()
+	WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	RETURNING version, updated_at, count_in_stock
+`
+
+// UpdateProduct writes the product only if it is still at p.Version and bumps
+// the version. A concurrent modification yields a *VersionConflictError. A
+// changed price is recorded in the price history. The stock is left alone,
+// p.CountInStock is set to the current count.
 func (repo *ProductRepository) UpdateProduct(ctx context.Context, p *entity.Product) (*entity.Product, error) {
-	_, err := repo.db.NamedExecContext(ctx, "UPDATE product SET name=:name, image=:image, category=:category, description=:description, rating=:rating, num_reviews=:num_reviews, price=:price, count_in_stock=:count_in_stock, updated_at=:updated_at WHERE id=:id", p)
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowContext(ctx, updateProduct,
+			p.ID,
+			p.Version,
+			p.Name,
+			p.Image,
+			p.Category,
+			p.Description,
+			p.Price,
+			p.CategoryID,
+			p.ReorderThreshold).
+			Scan(&p.Version, &p.UpdatedAt, &p.CountInStock)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return repo.versionConflict(ctx, p.ID, p.Version)
+		}
+		if err != nil {
+			return err
+		}
+
+		return updateProductPrices(ctx, tx, []int64{p.ID})
+	})
+
 	if err != nil {
-		return nil, fmt.Errorf("error updating product: %v", err)
+		return nil, fmt.Errorf("error updating product: %w", err)
 	}
 
 	return p, nil
 }
 
+// versionConflict explains why a conditional write on the product matched no
+// row: either the product is gone or it is at another version.
+func (repo *ProductRepository) versionConflict(ctx context.Context, id, expected int64) error {
+	var actual int64
+	err := repo.db.GetContext(ctx, &actual, "SELECT version FROM product WHERE id=$1 AND deleted_at IS NULL", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error updating product: %w", ErrProductNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error checking product version: %w", err)
+	}
+
+	return &VersionConflictError{Resource: "product", ID: id, Expected: expected, Actual: actual}
+}
+
+// DeleteProduct soft deletes the product by setting deleted_at.
 func (repo *ProductRepository) DeleteProduct(ctx context.Context, id int64) error {
-	_, err := repo.db.ExecContext(ctx, "DELETE FROM product WHERE id=?", id)
+	return repo.deleteProduct(ctx, id, nil)
+}
+
+// DeleteProductIfVersion is like DeleteProduct but only deletes the product
+// while it is still at the given version.
+func (repo *ProductRepository) DeleteProductIfVersion(ctx context.Context, id, version int64) error {
+	return repo.deleteProduct(ctx, id, &version)
+}
+
+func (repo *ProductRepository) deleteProduct(ctx context.Context, id int64, version *int64) error {
+	var where whereClause
+	where.add("id = ?", id)
+	where.add("deleted_at IS NULL")
+	if version != nil {
+		where.add("version = ?", *version)
+	}
+
+	query := sqlx.Rebind(sqlx.DOLLAR, "UPDATE product SET deleted_at = now(), version = version + 1"+where.String())
+	res, err := repo.db.ExecContext(ctx, query, where.args...)
 	if err != nil {
-		return fmt.Errorf("error deleting product: %v", err)
+		return fmt.Errorf("error deleting product: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting product: %w", err)
+	}
+	if n == 0 {
+		if version == nil {
+			return fmt.Errorf("error deleting product: %w", ErrProductNotFound)
+		}
+		return repo.versionConflict(ctx, id, *version)
 	}
 
 	return nil
 }
+
+// RestoreProduct clears deleted_at on a soft deleted product.
+func (repo *ProductRepository) RestoreProduct(ctx context.Context, id int64) (*entity.Product, error) {
+	var p entity.Product
+
+	err := repo.db.GetContext(ctx, &p, "UPDATE product SET deleted_at = NULL, version = version + 1, updated_at = now() WHERE id = $1 AND deleted_at IS NOT NULL RETURNING *", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error restoring product: %w", ErrProductNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error restoring product: %w", err)
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,343 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// bulkChunkSize bounds the rows per statement so that bulk writes stay well
+// below PostgreSQL's limit of 65535 bind parameters.
+const bulkChunkSize = 1000
+
+// errRollback makes execTx roll back an atomic bulk write that could not be
+// applied to every row.
+var errRollback = errors.New("rollback")
+
+// productValueTypes are the SQL types of the writable product columns in the
+// order they are bound by productValues. rating and num_reviews are maintained
+// by the reviews and never written here.
+var productValueTypes = []string{"varchar", "varchar", "varchar", "text", "decimal", "int", "int", "int"}
+
+func productValues(p *entity.Product) []interface{} {
+	return []interface{}{p.Name, p.Image, p.Category, p.Description, p.Price, p.CountInStock, p.CategoryID, p.ReorderThreshold}
+}
+
+// valuesRows renders rows tuples of typed placeholders for a VALUES list,
+// e.g. "($1::int, $2::varchar), ($3::int, $4::varchar)".
+func valuesRows(rows int, types []string) string {
+	var b strings.Builder
+	n := 1
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j, t := range types {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("$" + strconv.Itoa(n) + "::" + t)
+			n++
+		}
+		b.WriteString(")")
+	}
+
+	return b.String()
+}
+
+func chunks[T any](items []T, size int) [][]T {
+	var out [][]T
+	for size < len(items) {
+		items, out = items[size:], append(out, items[:size])
+	}
+
+	return append(out, items)
+}
+
+// CreateProducts inserts all products in one transaction using multi-row
+// INSERT statements and fills in their generated columns.
+func (repo *ProductRepository) CreateProducts(ctx context.Context, ps []*entity.Product) ([]*entity.Product, error) {
+	if len(ps) == 0 {
+		return ps, nil
+	}
+
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		for _, chunk := range chunks(ps, bulkChunkSize) {
+			if err := insertProducts(ctx, tx, chunk); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating products: %w", err)
+	}
+
+	return ps, nil
+}
+
+// insertProducts inserts ps with one statement. PostgreSQL does not return
+// the inserted rows in any particular order, so the IDs are drawn from the
+// sequence up front and every row comes back with the ordinal of its product.
+func insertProducts(ctx context.Context, tx *sqlx.Tx, ps []*entity.Product) error {
+	query := `WITH v (ord, name, image, category, description, price, count_in_stock, category_id, reorder_threshold) AS (VALUES ` +
+		valuesRows(len(ps), append([]string{"int"}, productValueTypes...)) + `), ` +
+		`ids AS (SELECT ord, nextval(pg_get_serial_sequence('product', 'id')) AS id FROM v), ` +
+		`ins AS (INSERT INTO product (id, name, image, category, description, price, count_in_stock, category_id, reorder_threshold) ` +
+		`SELECT ids.id, v.name, v.image, v.category, v.description, v.price, v.count_in_stock, v.category_id, v.reorder_threshold ` +
+		`FROM v JOIN ids USING (ord) RETURNING id, version, created_at, updated_at) ` +
+		`SELECT ids.ord, ins.id, ins.version, ins.created_at, ins.updated_at FROM ins JOIN ids USING (id)`
+
+	args := make([]interface{}, 0, len(ps)*(len(productValueTypes)+1))
+	for i, p := range ps {
+		args = append(args, i)
+		args = append(args, productValues(p)...)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error inserting products: %w", err)
+	}
+	defer rows.Close()
+
+	inserted := make([]bool, len(ps))
+	n := 0
+	var ord int
+	for rows.Next() {
+		var id, version int64
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&ord, &id, &version, &createdAt, &updatedAt); err != nil {
+			return fmt.Errorf("error inserting products: %w", err)
+		}
+		if ord < 0 || ord >= len(ps) || inserted[ord] {
+			return fmt.Errorf("error inserting products: unexpected row %d", ord)
+		}
+
+		p := ps[ord]
+		p.ID, p.Version, p.CreatedAt, p.UpdatedAt = id, version, createdAt, updatedAt
+		inserted[ord] = true
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error inserting products: %w", err)
+	}
+	if n != len(ps) {
+		return fmt.Errorf("error inserting products: inserted %d of %d rows", n, len(ps))
+	}
+
+	ids := make([]int64, 0, len(ps))
+	var movements []*entity.StockMovement
+	for _, p := range ps {
+		ids = append(ids, p.ID)
+		movements = append(movements, initialStock(p.ID, nil, p.CountInStock)...)
+	}
+
+	if err := insertProductPrices(ctx, tx, ids); err != nil {
+		return err
+	}
+
+	return recordStockMovements(ctx, tx, movements)
+}
+
+// UpdateProducts writes all products with UPDATE ... FROM (VALUES ...), each
+// only while it is still at its Version, and bumps the versions. Changed
+// prices are recorded in the price history. The stock is left alone, instead
+// CountInStock is set to the current count. It returns the IDs of products
+// that were deleted or modified concurrently. With atomic set nothing is
+// written unless every product could be updated.
+func (repo *ProductRepository) UpdateProducts(ctx context.Context, ps []*entity.Product, atomic bool) ([]int64, error) {
+	var missed []int64
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		for _, chunk := range chunks(ps, bulkChunkSize) {
+			m, err := updateProducts(ctx, tx, chunk)
+			if err != nil {
+				return err
+			}
+			missed = append(missed, m...)
+		}
+
+		if atomic && len(missed) > 0 {
+			return errRollback
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, errRollback) {
+		return missed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating products: %w", err)
+	}
+
+	return missed, nil
+}
+
+func updateProducts(ctx context.Context, tx *sqlx.Tx, ps []*entity.Product) ([]int64, error) {
+	if len(ps) == 0 {
+		return nil, nil
+	}
+
+	query := `UPDATE product AS p SET name = v.name, image = v.image, category = v.category, ` +
+		`description = v.description, price = v.price, ` +
+		`category_id = v.category_id, reorder_threshold = v.reorder_threshold, version = p.version + 1, updated_at = now() ` +
+		`FROM (VALUES ` + valuesRows(len(ps), append([]string{"int", "int"}, productValueTypes...)) + `) ` +
+		`AS v(id, version, name, image, category, description, price, count_in_stock, category_id, reorder_threshold) ` +
+		`WHERE p.id = v.id AND p.version = v.version AND p.deleted_at IS NULL ` +
+		`RETURNING p.id, p.version, p.updated_at, p.count_in_stock`
+
+	args := make([]interface{}, 0, len(ps)*(len(productValueTypes)+2))
+	byID := make(map[int64]*entity.Product, len(ps))
+	for _, p := range ps {
+		args = append(args, p.ID, p.Version)
+		args = append(args, productValues(p)...)
+		byID[p.ID] = p
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error updating products: %w", err)
+	}
+	defer rows.Close()
+
+	updated := make(map[int64]bool, len(ps))
+	var id, version, count int64
+	var updatedAt time.Time
+	for rows.Next() {
+		if err := rows.Scan(&id, &version, &updatedAt, &count); err != nil {
+			return nil, fmt.Errorf("error updating products: %w", err)
+		}
+		byID[id].Version = version
+		byID[id].UpdatedAt = updatedAt
+		byID[id].CountInStock = count
+		updated[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error updating products: %w", err)
+	}
+	rows.Close()
+
+	var missed, ids []int64
+	for _, p := range ps {
+		if !updated[p.ID] {
+			missed = append(missed, p.ID)
+			continue
+		}
+		ids = append(ids, p.ID)
+	}
+
+	if len(ids) > 0 {
+		if err := updateProductPrices(ctx, tx, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	return missed, nil
+}
+
+// DeleteProducts soft deletes the products and returns the IDs that did not
+// exist or were already deleted. With atomic set nothing is deleted unless
+// every product could be deleted.
+func (repo *ProductRepository) DeleteProducts(ctx context.Context, ids []int64, atomic bool) ([]int64, error) {
+	var missed []int64
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		var deleted []int64
+		err := tx.SelectContext(ctx, &deleted,
+			"UPDATE product SET deleted_at = now(), version = version + 1 WHERE id = ANY($1) AND deleted_at IS NULL RETURNING id",
+			pq.Array(ids))
+		if err != nil {
+			return fmt.Errorf("error deleting products: %w", err)
+		}
+
+		found := make(map[int64]bool, len(deleted))
+		for _, id := range deleted {
+			found[id] = true
+		}
+		for _, id := range ids {
+			if !found[id] {
+				missed = append(missed, id)
+			}
+		}
+
+		if atomic && len(missed) > 0 {
+			return errRollback
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, errRollback) {
+		return missed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error deleting products: %w", err)
+	}
+
+	return missed, nil
+}
+
+// GetProducts returns the products with the given IDs that are not deleted.
+func (repo *ProductRepository) GetProducts(ctx context.Context, ids []int64) ([]entity.Product, error) {
+	products := []entity.Product{}
+	err := repo.db.SelectContext(ctx, &products, "SELECT * FROM product WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error getting products: %w", err)
+	}
+
+	return products, nil
+}
+
+// GetProductsByName returns the products that are not deleted and carry one of
+// the given names, oldest first.
+func (repo *ProductRepository) GetProductsByName(ctx context.Context, names []string) ([]entity.Product, error) {
+	products := []entity.Product{}
+	err := repo.db.SelectContext(ctx, &products, "SELECT * FROM product WHERE name = ANY($1) AND deleted_at IS NULL ORDER BY id", pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("error getting products: %w", err)
+	}
+
+	return products, nil
+}
+
+// UpsertProducts inserts creates and updates updates in one transaction. The
+// updates are conditional on their Version like in UpdateProducts, the IDs of
+// those that were modified concurrently are returned.
+func (repo *ProductRepository) UpsertProducts(ctx context.Context, creates, updates []*entity.Product) ([]int64, error) {
+	var missed []int64
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		for _, chunk := range chunks(updates, bulkChunkSize) {
+			m, err := updateProducts(ctx, tx, chunk)
+			if err != nil {
+				return err
+			}
+			missed = append(missed, m...)
+		}
+
+		if len(creates) == 0 {
+			return nil
+		}
+		for _, chunk := range chunks(creates, bulkChunkSize) {
+			if err := insertProducts(ctx, tx, chunk); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error upserting products: %w", err)
+	}
+
+	return missed, nil
+}
@@ -0,0 +1,347 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	expectInsertProducts = `WITH v (ord, name, image, category, description, price, count_in_stock, category_id, reorder_threshold) AS (VALUES ` +
+		`($1::int, $2::varchar, $3::varchar, $4::varchar, $5::text, $6::decimal, $7::int, $8::int, $9::int), ` +
+		`($10::int, $11::varchar, $12::varchar, $13::varchar, $14::text, $15::decimal, $16::int, $17::int, $18::int)), ` +
+		expectInsertProductsFrom
+	expectInsertProductsFrom = `ids AS (SELECT ord, nextval(pg_get_serial_sequence('product', 'id')) AS id FROM v), ` +
+		`ins AS (INSERT INTO product (id, name, image, category, description, price, count_in_stock, category_id, reorder_threshold) ` +
+		`SELECT ids.id, v.name, v.image, v.category, v.description, v.price, v.count_in_stock, v.category_id, v.reorder_threshold ` +
+		`FROM v JOIN ids USING (ord) RETURNING id, version, created_at, updated_at) ` +
+		`SELECT ids.ord, ins.id, ins.version, ins.created_at, ins.updated_at FROM ins JOIN ids USING (id)`
+	expectUpdateProducts = `UPDATE product AS p SET name = v.name, image = v.image, category = v.category, ` +
+		`description = v.description, price = v.price, ` +
+		`category_id = v.category_id, reorder_threshold = v.reorder_threshold, version = p.version + 1, updated_at = now() ` +
+		`FROM (VALUES ($1::int, $2::int, $3::varchar, $4::varchar, $5::varchar, $6::text, $7::decimal, $8::int, $9::int, $10::int), ` +
+		`($11::int, $12::int, $13::varchar, $14::varchar, $15::varchar, $16::text, $17::decimal, $18::int, $19::int, $20::int)) ` +
+		`AS v(id, version, name, image, category, description, price, count_in_stock, category_id, reorder_threshold) ` +
+		`WHERE p.id = v.id AND p.version = v.version AND p.deleted_at IS NULL ` +
+		`RETURNING p.id, p.version, p.updated_at, p.count_in_stock`
+	expectDeleteProducts = `UPDATE product SET deleted_at = now(), version = version + 1 WHERE id = ANY($1) AND deleted_at IS NULL RETURNING id`
+)
+
+func newTestProducts() []*entity.Product {
+	return []*entity.Product{
+		{ID: 1, Version: 1, Name: "test product", Image: "test.png", Category: "test category", CategoryID: 3, Rating: 5, Price: 100.0, CountInStock: 10, ReorderThreshold: 3},
+		{ID: 2, Version: 3, Name: "test product 2", Image: "test2.png", Category: "test category", CategoryID: 3, Rating: 4, Price: 50.0, CountInStock: 0},
+	}
+}
+
+func TestValuesRows(t *testing.T) {
+	require.Equal(t, "($1::int, $2::text), ($3::int, $4::text)", valuesRows(2, []string{"int", "text"}))
+	require.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, chunks([]int{1, 2, 3, 4, 5}, 2))
+}
+
+func TestCreateProducts(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				ps := newTestProducts()
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertProducts).
+					WithArgs(
+						0, ps[0].Name, ps[0].Image, ps[0].Category, ps[0].Description, ps[0].Price, ps[0].CountInStock, ps[0].CategoryID, ps[0].ReorderThreshold,
+						1, ps[1].Name, ps[1].Image, ps[1].Category, ps[1].Description, ps[1].Price, ps[1].CountInStock, ps[1].CategoryID, ps[1].ReorderThreshold).
+					// the rows come back in any order and are matched by ordinal
+					WillReturnRows(sqlmock.NewRows([]string{"ord", "id", "version", "created_at", "updated_at"}).
+						AddRow(1, 8, 1, now, now).
+						AddRow(0, 7, 1, now, now))
+				mock.ExpectExec(expectInsertPrices).WithArgs(pq.Array([]int64{7, 8})).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(expectInsertMovements(1)).
+					WithArgs(int64(7), nil, int64(10), "restock", nil, "").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				created, err := repo.CreateProducts(context.Background(), ps)
+				require.NoError(t, err)
+				require.Equal(t, int64(7), created[0].ID)
+				require.Equal(t, int64(8), created[1].ID)
+				require.Equal(t, int64(1), created[1].Version)
+				require.Equal(t, now, created[1].CreatedAt)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed inserting products",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertProducts).WillReturnError(fmt.Errorf("error inserting products"))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateProducts(context.Background(), newTestProducts())
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestUpdateProducts(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				ps := newTestProducts()
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProducts).
+					WithArgs(
+						ps[0].ID, ps[0].Version, ps[0].Name, ps[0].Image, ps[0].Category, ps[0].Description, ps[0].Price, ps[0].CountInStock, ps[0].CategoryID, ps[0].ReorderThreshold,
+						ps[1].ID, ps[1].Version, ps[1].Name, ps[1].Image, ps[1].Category, ps[1].Description, ps[1].Price, ps[1].CountInStock, ps[1].CategoryID, ps[1].ReorderThreshold).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "updated_at", "count_in_stock"}).
+						AddRow(2, 4, now, 0).
+						AddRow(1, 2, now, 8))
+				mock.ExpectExec(expectRecordPrices).WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				missed, err := repo.UpdateProducts(context.Background(), ps, true)
+				require.NoError(t, err)
+				require.Empty(t, missed)
+				require.Equal(t, int64(2), ps[0].Version)
+				require.Equal(t, int64(4), ps[1].Version)
+				require.Equal(t, now, ps[0].UpdatedAt)
+				// product 1 was read with 10 in stock, 2 have been sold since
+				require.Equal(t, int64(8), ps[0].CountInStock)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "best effort with conflict",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProducts).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "updated_at", "count_in_stock"}).AddRow(1, 2, time.Now(), 10))
+				mock.ExpectExec(expectRecordPrices).WithArgs(pq.Array([]int64{1})).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				missed, err := repo.UpdateProducts(context.Background(), newTestProducts(), false)
+				require.NoError(t, err)
+				require.Equal(t, []int64{2}, missed)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "atomic with conflict",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProducts).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "updated_at", "count_in_stock"}).AddRow(1, 2, time.Now(), 10))
+				mock.ExpectExec(expectRecordPrices).WithArgs(pq.Array([]int64{1})).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				missed, err := repo.UpdateProducts(context.Background(), newTestProducts(), true)
+				require.NoError(t, err)
+				require.Equal(t, []int64{2}, missed)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestDeleteProducts(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectDeleteProducts).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+				mock.ExpectCommit()
+
+				missed, err := repo.DeleteProducts(context.Background(), []int64{1, 2}, true)
+				require.NoError(t, err)
+				require.Empty(t, missed)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "best effort with missing product",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectDeleteProducts).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+
+				missed, err := repo.DeleteProducts(context.Background(), []int64{1, 2}, false)
+				require.NoError(t, err)
+				require.Equal(t, []int64{2}, missed)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "atomic with missing product",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectDeleteProducts).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectRollback()
+
+				missed, err := repo.DeleteProducts(context.Background(), []int64{1, 2}, true)
+				require.NoError(t, err)
+				require.Equal(t, []int64{2}, missed)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestGetProductsByName(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		repo := NewProductRepository(db)
+		p := newTestProducts()[0]
+
+		mock.ExpectQuery("SELECT * FROM product WHERE name = ANY($1) AND deleted_at IS NULL ORDER BY id").
+			WithArgs(pq.Array([]string{p.Name, "missing"})).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "version", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock"}).
+				AddRow(p.ID, p.Version, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock))
+
+		products, err := repo.GetProductsByName(context.Background(), []string{p.Name, "missing"})
+		require.NoError(t, err)
+		require.Len(t, products, 1)
+		require.Equal(t, p.Name, products[0].Name)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestUpsertProducts(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				ps := newTestProducts()
+				creates := []*entity.Product{{Name: "new product", Category: "test category", CategoryID: 3, Price: 10.0}}
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProducts).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "updated_at", "count_in_stock"}).
+						AddRow(1, 2, now, 10))
+				mock.ExpectExec(expectRecordPrices).WithArgs(pq.Array([]int64{1})).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`WITH v (ord, name, image, category, description, price, count_in_stock, category_id, reorder_threshold) AS (VALUES `+
+					`($1::int, $2::varchar, $3::varchar, $4::varchar, $5::text, $6::decimal, $7::int, $8::int, $9::int)), `+
+					expectInsertProductsFrom).
+					WithArgs(0, creates[0].Name, creates[0].Image, creates[0].Category, creates[0].Description,
+						creates[0].Price, creates[0].CountInStock, creates[0].CategoryID, creates[0].ReorderThreshold).
+					WillReturnRows(sqlmock.NewRows([]string{"ord", "id", "version", "created_at", "updated_at"}).AddRow(0, 9, 1, now, now))
+				mock.ExpectExec(expectInsertPrices).WithArgs(pq.Array([]int64{9})).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				missed, err := repo.UpsertProducts(context.Background(), creates, ps)
+				require.NoError(t, err)
+				require.Equal(t, []int64{2}, missed)
+				require.Equal(t, int64(2), ps[0].Version)
+				require.Equal(t, int64(9), creates[0].ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed inserting products",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertProducts).WillReturnError(fmt.Errorf("error inserting products"))
+				mock.ExpectRollback()
+
+				_, err := repo.UpsertProducts(context.Background(), newTestProducts(), nil)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
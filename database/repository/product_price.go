@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPriceNotFound error = apperror.NotFound("price_not_found", "price not found")
+	ErrPriceInEffect error = apperror.Conflict("price_in_effect", "only scheduled prices that are not in effect yet can be deleted")
+)
+
+type ProductPriceRepository struct {
+	db *sqlx.DB
+}
+
+func NewProductPriceRepository(db *sqlx.DB) *ProductPriceRepository {
+	return &ProductPriceRepository{
+		db: db,
+	}
+}
+
+// Every change of the price history of a product locks the product first, so
+// that concurrent changes do not tear its ranges apart.
+const lockPricedProduct = `SELECT id FROM product WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+
+// insertInitialPrices starts the price history of new products.
+const insertInitialPrices = `
+	INSERT INTO product_price (product_id, price, effective_from)
+	SELECT id, price, now() FROM product WHERE id = ANY($1)
+`
+
+// recordProductPrices ends the effective range of every product whose price
+// was written directly and continues it with the new price, up to the next
+// scheduled change if there is one.
+const recordProductPrices = `
+	WITH changed AS (
+		SELECT pp.id, pp.product_id, pp.effective_to, p.price
+		FROM product_price pp
+		JOIN product p ON p.id = pp.product_id
+		WHERE pp.product_id = ANY($1) AND pp.price <> p.price
+			AND pp.effective_from <= now() AND (pp.effective_to IS NULL OR pp.effective_to > now())
+		FOR UPDATE OF pp
+	), closed AS (
+		UPDATE product_price pp SET effective_to = now() FROM changed c WHERE pp.id = c.id
+	)
+	INSERT INTO product_price (product_id, price, effective_from, effective_to)
+	SELECT product_id, price, now(), effective_to FROM changed
+`
+
+// applyScheduledPrices copies the prices that came into effect onto their
+// products.
+const applyScheduledPrices = `
+	UPDATE product p SET price = pp.price, version = p.version + 1, updated_at = now()
+	FROM product_price pp
+	WHERE pp.product_id = p.id AND p.deleted_at IS NULL AND p.price <> pp.price
+		AND pp.effective_from <= now() AND (pp.effective_to IS NULL OR pp.effective_to > now())
+`
+
+const (
+	updatePriceAt = `UPDATE product_price SET price = $3 WHERE product_id = $1 AND effective_from = $2 RETURNING *`
+	closePriceAt  = `
+		UPDATE product_price SET effective_to = $2
+		WHERE product_id = $1 AND effective_from < $2 AND (effective_to IS NULL OR effective_to > $2)
+	`
+	insertPriceAt = `
+		INSERT INTO product_price (product_id, price, effective_from, effective_to)
+		VALUES ($1, $3, $2, (SELECT MIN(effective_from) FROM product_price WHERE product_id = $1 AND effective_from > $2))
+		RETURNING *
+	`
+)
+
+// deleteScheduledPrice only deletes prices that are not in effect yet.
+const deleteScheduledPrice = `
+	DELETE FROM product_price
+	WHERE id = $1 AND product_id = $2 AND effective_from > now()
+	RETURNING effective_from, effective_to
+`
+
+func insertProductPrices(ctx context.Context, tx *sqlx.Tx, ids []int64) error {
+	_, err := tx.ExecContext(ctx, insertInitialPrices, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error inserting prices: %w", err)
+	}
+
+	return nil
+}
+
+// updateProductPrices records the prices the products were just updated to in
+// their price history. Unchanged prices are left alone.
+func updateProductPrices(ctx context.Context, tx *sqlx.Tx, ids []int64) error {
+	_, err := tx.ExecContext(ctx, recordProductPrices, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error recording prices: %w", err)
+	}
+
+	return nil
+}
+
+// SchedulePrice changes the price of the product at the given time, right away
+// when at is nil. The new price holds until the next scheduled change. A price
+// that starts at the very same time is replaced.
+func (repo *ProductPriceRepository) SchedulePrice(ctx context.Context, productID int64, price float64, at *time.Time) (*entity.ProductPrice, error) {
+	var pp entity.ProductPrice
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		var id int64
+		err := tx.GetContext(ctx, &id, lockPricedProduct, productID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error locking product: %w", err)
+		}
+
+		// effective_from is a timestamptz, so the offset of at is kept
+		var from time.Time
+		if err := tx.GetContext(ctx, &from, "SELECT COALESCE($1::timestamptz, now())", at); err != nil {
+			return fmt.Errorf("error resolving effective time: %w", err)
+		}
+
+		err = tx.GetContext(ctx, &pp, updatePriceAt, productID, from, price)
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, err := tx.ExecContext(ctx, closePriceAt, productID, from); err != nil {
+				return fmt.Errorf("error closing price: %w", err)
+			}
+			err = tx.GetContext(ctx, &pp, insertPriceAt, productID, from, price)
+		}
+		if err != nil {
+			return fmt.Errorf("error inserting price: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, applyScheduledPrices+" AND p.id = $1", productID)
+		if err != nil {
+			return fmt.Errorf("error applying price: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error scheduling price: %w", err)
+	}
+
+	return &pp, nil
+}
+
+// ListPrices returns the price history of the product including scheduled
+// changes, oldest first. With at set only the price effective at that time is
+// returned.
+func (repo *ProductPriceRepository) ListPrices(ctx context.Context, productID int64, at *time.Time) ([]entity.ProductPrice, error) {
+	var where whereClause
+	where.add("product_id = ?", productID)
+	if at != nil {
+		where.add("effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)", *at, *at)
+	}
+
+	prices := []entity.ProductPrice{}
+	err := repo.db.SelectContext(ctx, &prices, sqlx.Rebind(sqlx.DOLLAR, "SELECT * FROM product_price"+where.String()+" ORDER BY effective_from"), where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing prices: %w", err)
+	}
+
+	return prices, nil
+}
+
+// DeletePrice cancels a scheduled price change. The price before it holds
+// until the change after it.
+func (repo *ProductPriceRepository) DeletePrice(ctx context.Context, productID, id int64) error {
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		var locked int64
+		err := tx.GetContext(ctx, &locked, lockPricedProduct, productID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error locking product: %w", err)
+		}
+
+		var deleted entity.ProductPrice
+		err = tx.QueryRowContext(ctx, deleteScheduledPrice, id, productID).Scan(&deleted.EffectiveFrom, &deleted.EffectiveTo)
+		if errors.Is(err, sql.ErrNoRows) {
+			var exists bool
+			err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM product_price WHERE id = $1 AND product_id = $2)", id, productID)
+			if err != nil {
+				return fmt.Errorf("error checking price: %w", err)
+			}
+			if exists {
+				return ErrPriceInEffect
+			}
+			return ErrPriceNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting price: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE product_price SET effective_to = $3 WHERE product_id = $1 AND effective_to = $2",
+			productID, deleted.EffectiveFrom, deleted.EffectiveTo)
+		if err != nil {
+			return fmt.Errorf("error extending price: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error deleting price: %w", err)
+	}
+
+	return nil
+}
+
+// ApplyScheduledPrices brings the cached price of every product up to date
+// with its price history and returns how many products changed their price.
+func (repo *ProductPriceRepository) ApplyScheduledPrices(ctx context.Context) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, applyScheduledPrices)
+	if err != nil {
+		return 0, fmt.Errorf("error applying scheduled prices: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error applying scheduled prices: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	expectInsertPrices = `INSERT INTO product_price (product_id, price, effective_from) SELECT id, price, now() FROM product WHERE id = ANY($1)`
+	expectRecordPrices = `WITH changed AS ( SELECT pp.id, pp.product_id, pp.effective_to, p.price FROM product_price pp JOIN product p ON p.id = pp.product_id ` +
+		`WHERE pp.product_id = ANY($1) AND pp.price <> p.price AND pp.effective_from <= now() AND (pp.effective_to IS NULL OR pp.effective_to > now()) FOR UPDATE OF pp ), ` +
+		`closed AS ( UPDATE product_price pp SET effective_to = now() FROM changed c WHERE pp.id = c.id ) ` +
+		`INSERT INTO product_price (product_id, price, effective_from, effective_to) SELECT product_id, price, now(), effective_to FROM changed`
+	expectApplyScheduledPrices = `UPDATE product p SET price = pp.price, version = p.version + 1, updated_at = now() FROM product_price pp ` +
+		`WHERE pp.product_id = p.id AND p.deleted_at IS NULL AND p.price <> pp.price AND pp.effective_from <= now() AND (pp.effective_to IS NULL OR pp.effective_to > now())`
+	expectLockPricedProduct = `SELECT id FROM product WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	expectPriceTime         = `SELECT COALESCE($1::timestamptz, now())`
+	expectUpdatePriceAt     = `UPDATE product_price SET price = $3 WHERE product_id = $1 AND effective_from = $2 RETURNING *`
+	expectClosePriceAt      = `UPDATE product_price SET effective_to = $2 WHERE product_id = $1 AND effective_from < $2 AND (effective_to IS NULL OR effective_to > $2)`
+	expectInsertPriceAt     = `INSERT INTO product_price (product_id, price, effective_from, effective_to) VALUES ($1, $3, $2, (SELECT MIN(effective_from) FROM product_price WHERE product_id = $1 AND effective_from > $2)) RETURNING *`
+	expectDeletePrice       = `DELETE FROM product_price WHERE id = $1 AND product_id = $2 AND effective_from > now() RETURNING effective_from, effective_to`
+)
+
+var productPriceCols = []string{"id", "created_at", "product_id", "price", "effective_from", "effective_to"}
+
+func TestSchedulePrice(t *testing.T) {
+	at := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductPriceRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "new price",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockPricedProduct).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(expectPriceTime).WithArgs(&at).
+					WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(at))
+				mock.ExpectQuery(expectUpdatePriceAt).WithArgs(1, at, 9.5).
+					WillReturnRows(sqlmock.NewRows(productPriceCols))
+				mock.ExpectExec(expectClosePriceAt).WithArgs(1, at).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(expectInsertPriceAt).WithArgs(1, at, 9.5).
+					WillReturnRows(sqlmock.NewRows(productPriceCols).AddRow(5, now, 1, 9.5, at, nil))
+				mock.ExpectExec(expectApplyScheduledPrices + " AND p.id = $1").WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				pp, err := repo.SchedulePrice(context.Background(), 1, 9.5, &at)
+				require.NoError(t, err)
+				require.Equal(t, int64(5), pp.ID)
+				require.Equal(t, at, pp.EffectiveFrom)
+				require.Nil(t, pp.EffectiveTo)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "replace scheduled price",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockPricedProduct).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(expectPriceTime).WithArgs(&at).
+					WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(at))
+				mock.ExpectQuery(expectUpdatePriceAt).WithArgs(1, at, 9.5).
+					WillReturnRows(sqlmock.NewRows(productPriceCols).AddRow(5, now, 1, 9.5, at, nil))
+				mock.ExpectExec(expectApplyScheduledPrices + " AND p.id = $1").WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				pp, err := repo.SchedulePrice(context.Background(), 1, 9.5, &at)
+				require.NoError(t, err)
+				require.Equal(t, int64(5), pp.ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "product not found",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockPricedProduct).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				_, err := repo.SchedulePrice(context.Background(), 1, 9.5, nil)
+				require.ErrorIs(t, err, ErrProductNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductPriceRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestListPrices(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductPriceRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "history",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT * FROM product_price WHERE product_id = $1 ORDER BY effective_from`).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(productPriceCols).
+						AddRow(1, from, 1, 10.0, from, to).
+						AddRow(2, from, 1, 12.0, to, nil))
+
+				prices, err := repo.ListPrices(context.Background(), 1, nil)
+				require.NoError(t, err)
+				require.Len(t, prices, 2)
+				require.Equal(t, to, *prices[0].EffectiveTo)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "at a date",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				at := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+				mock.ExpectQuery(`SELECT * FROM product_price WHERE product_id = $1 AND effective_from <= $2 AND (effective_to IS NULL OR effective_to > $3) ORDER BY effective_from`).
+					WithArgs(1, at, at).
+					WillReturnRows(sqlmock.NewRows(productPriceCols).AddRow(1, from, 1, 10.0, from, to))
+
+				prices, err := repo.ListPrices(context.Background(), 1, &at)
+				require.NoError(t, err)
+				require.Len(t, prices, 1)
+				require.Equal(t, 10.0, prices[0].Price)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductPriceRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestDeletePrice(t *testing.T) {
+	from := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductPriceRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockPricedProduct).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(expectDeletePrice).WithArgs(5, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"effective_from", "effective_to"}).AddRow(from, nil))
+				mock.ExpectExec(`UPDATE product_price SET effective_to = $3 WHERE product_id = $1 AND effective_to = $2`).
+					WithArgs(1, from, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := repo.DeletePrice(context.Background(), 1, 5)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "price in effect",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockPricedProduct).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(expectDeletePrice).WithArgs(5, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"effective_from", "effective_to"}))
+				mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM product_price WHERE id = $1 AND product_id = $2)`).WithArgs(5, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectRollback()
+
+				err := repo.DeletePrice(context.Background(), 1, 5)
+				require.ErrorIs(t, err, ErrPriceInEffect)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockPricedProduct).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(expectDeletePrice).WithArgs(5, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"effective_from", "effective_to"}))
+				mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM product_price WHERE id = $1 AND product_id = $2)`).WithArgs(5, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectRollback()
+
+				err := repo.DeletePrice(context.Background(), 1, 5)
+				require.ErrorIs(t, err, ErrPriceNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductPriceRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestApplyScheduledPrices(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductPriceRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(expectApplyScheduledPrices).WillReturnResult(sqlmock.NewResult(0, 3))
+
+				n, err := repo.ApplyScheduledPrices(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, int64(3), n)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed",
+			test: func(t *testing.T, repo *ProductPriceRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(expectApplyScheduledPrices).WillReturnError(fmt.Errorf("error applying scheduled prices"))
+
+				_, err := repo.ApplyScheduledPrices(context.Background())
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductPriceRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
@@ -1,14 +1,17 @@
 package repository
 
 import (
+	"chi-sqlx/apperror"
 	"chi-sqlx/database/entity"
 	"context"
+	"database/sql"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,6 +32,7 @@ func TestCreateProduct(t *testing.T) {
 		Name:         "test product",
 		Image:        "test.png",
 		Category:     "test category",
+		CategoryID:   3,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
@@ -48,10 +52,17 @@ func TestCreateProduct(t *testing.T) {
 				expectedCreatedAt := time.Now()
 				expectedUpdatedAt := time.Now()
 
-				mock.ExpectQuery("INSERT INTO product (name, image, category, description, rating, num_reviews, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at").
-					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-						AddRow(expectedID, expectedCreatedAt, expectedUpdatedAt))
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO product (name, image, category, description, price, count_in_stock, category_id, reorder_threshold) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, version, created_at, updated_at").
+					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Price, p.CountInStock, p.CategoryID, p.ReorderThreshold).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at"}).
+						AddRow(expectedID, 1, expectedCreatedAt, expectedUpdatedAt))
+				mock.ExpectExec(expectInsertPrices).WithArgs(pq.Array([]int64{1})).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(expectInsertMovements(1)).
+					WithArgs(expectedID, nil, p.CountInStock, "restock", nil, "").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 
 				record, err := repo.CreateProduct(context.Background(), p)
 				require.NoError(t, err)
@@ -67,9 +78,11 @@ func TestCreateProduct(t *testing.T) {
 		{
 			name: "failed inserting product",
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("INSERT INTO product (name, image, category, description, rating, num_reviews, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at").
-					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock).
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO product (name, image, category, description, price, count_in_stock, category_id, reorder_threshold) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, version, created_at, updated_at").
+					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Price, p.CountInStock, p.CategoryID, p.ReorderThreshold).
 					WillReturnError(fmt.Errorf("error inserting product"))
+				mock.ExpectRollback()
 
 				_, err := repo.CreateProduct(context.Background(), p)
 				require.Error(t, err)
@@ -95,6 +108,7 @@ func TestGetProduct(t *testing.T) {
 		Name:         "test product",
 		Image:        "test.png",
 		Category:     "test category",
+		CategoryID:   3,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
@@ -111,7 +125,7 @@ func TestGetProduct(t *testing.T) {
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
 				rows := sqlmock.NewRows([]string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at", "deleted_at"}).
 					AddRow(1, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, p.CreatedAt, p.UpdatedAt, p.DeletedAt)
-				mock.ExpectQuery("SELECT * FROM product WHERE id=$1").WithArgs(1).WillReturnRows(rows)
+				mock.ExpectQuery("SELECT * FROM product WHERE id=$1 AND deleted_at IS NULL").WithArgs(1).WillReturnRows(rows)
 
 				record, err := repo.GetProduct(context.Background(), 1)
 				require.NoError(t, err)
@@ -124,11 +138,24 @@ func TestGetProduct(t *testing.T) {
 		{
 			name: "failed getting product",
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT * FROM product WHERE id=$1").WithArgs(1).WillReturnError(fmt.Errorf("error getting product"))
+				mock.ExpectQuery("SELECT * FROM product WHERE id=$1 AND deleted_at IS NULL").WithArgs(1).WillReturnError(fmt.Errorf("error getting product"))
 
 				_, err := repo.GetProduct(context.Background(), 1)
 				require.Error(t, err)
 
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "product not found",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM product WHERE id=$1 AND deleted_at IS NULL").WithArgs(1).WillReturnError(sql.ErrNoRows)
+
+				_, err := repo.GetProduct(context.Background(), 1)
+				require.ErrorIs(t, err, ErrProductNotFound)
+				require.ErrorIs(t, err, apperror.ErrNotFound)
+
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
 			},
@@ -150,12 +177,15 @@ func TestListProduct(t *testing.T) {
 		Name:         "test product",
 		Image:        "test.png",
 		Category:     "test category",
+		CategoryID:   3,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
 		Price:        1000.0,
 		CountInStock: 10,
 	}
+	cols := []string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at", "deleted_at"}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
 	tcs := []struct {
 		name string
@@ -164,13 +194,143 @@ func TestListProduct(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at", "deleted_at"}).
-					AddRow(1, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, p.CreatedAt, p.UpdatedAt, p.DeletedAt)
-				mock.ExpectQuery("SELECT * FROM product").WillReturnRows(rows)
+				rows := sqlmock.NewRows(cols).
+					AddRow(1, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, createdAt, createdAt, nil)
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL ORDER BY created_at, id LIMIT $1").WithArgs(DefaultPageLimit + 1).WillReturnRows(rows)
+
+				page, err := repo.ListProducts(context.Background(), entity.ProductFilter{}, entity.Pagination{})
+				require.NoError(t, err)
+				require.Len(t, page.Items, 1)
+				require.Nil(t, page.NextCursor)
+				require.Nil(t, page.Total)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "next page by cursor with total",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				cursor := &entity.Cursor{CreatedAt: createdAt, ID: 1}
+				rows := sqlmock.NewRows(cols).
+					AddRow(2, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, createdAt, createdAt, nil).
+					AddRow(3, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, createdAt, createdAt, nil).
+					AddRow(4, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, createdAt, createdAt, nil)
+				mock.ExpectQuery("SELECT count(*) FROM product WHERE deleted_at IS NULL").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL AND (created_at, id) > ($1, $2) ORDER BY created_at, id LIMIT $3").
+					WithArgs(createdAt, 1, 3).WillReturnRows(rows)
+
+				page, err := repo.ListProducts(context.Background(), entity.ProductFilter{}, entity.Pagination{Limit: 2, Cursor: cursor, WithTotal: true})
+				require.NoError(t, err)
+				require.Len(t, page.Items, 2)
+				require.Equal(t, int64(4), *page.Total)
+				require.Equal(t, &entity.Cursor{CreatedAt: createdAt, ID: 3}, page.NextCursor)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "offset",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL ORDER BY created_at, id LIMIT $1 OFFSET $2").
+					WithArgs(MaxPageLimit+1, 40).WillReturnRows(sqlmock.NewRows(cols))
+
+				page, err := repo.ListProducts(context.Background(), entity.ProductFilter{}, entity.Pagination{Limit: 1000, Offset: 40})
+				require.NoError(t, err)
+				require.Empty(t, page.Items)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "filtered and sorted",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				categoryID, minPrice, maxPrice, minRating := int64(3), 10.0, 500.0, int64(4)
+				after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+				filter := entity.ProductFilter{
+					CategoryID:   &categoryID,
+					MinPrice:     &minPrice,
+					MaxPrice:     &maxPrice,
+					MinRating:    &minRating,
+					InStock:      true,
+					CreatedAfter: &after,
+					Sort:         []entity.SortField{{Field: "price"}, {Field: "created_at", Desc: true}},
+				}
+
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL AND category_id = $1 AND price >= $2 AND price <= $3 AND rating >= $4 AND count_in_stock > 0 AND created_at >= $5 ORDER BY price ASC, created_at DESC, id ASC LIMIT $6").
+					WithArgs(categoryID, minPrice, maxPrice, minRating, after, DefaultPageLimit+1).
+					WillReturnRows(sqlmock.NewRows(cols))
+
+				_, err := repo.ListProducts(context.Background(), filter, entity.Pagination{})
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "category by name or slug",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL AND category_id IN (SELECT id FROM category WHERE name = $1 OR slug = $2) ORDER BY created_at, id LIMIT $3").
+					WithArgs("Audio", "Audio", DefaultPageLimit+1).
+					WillReturnRows(sqlmock.NewRows(cols))
+
+				_, err := repo.ListProducts(context.Background(), entity.ProductFilter{Category: "Audio"}, entity.Pagination{})
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "category subtree by name or slug",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL AND category_id IN ( WITH RECURSIVE subtree AS ( SELECT id FROM category WHERE name = $1 OR slug = $2 UNION ALL SELECT c.id FROM category c JOIN subtree s ON c.parent_id = s.id ) SELECT id FROM subtree) ORDER BY created_at, id LIMIT $3").
+					WithArgs("audio", "audio", DefaultPageLimit+1).
+					WillReturnRows(sqlmock.NewRows(cols))
+
+				filter := entity.ProductFilter{Category: "audio", IncludeDescendants: true}
+				_, err := repo.ListProducts(context.Background(), filter, entity.Pagination{})
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "include deleted",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM product ORDER BY created_at, id LIMIT $1").WillReturnRows(sqlmock.NewRows(cols))
+
+				_, err := repo.ListProducts(context.Background(), entity.ProductFilter{IncludeDeleted: true}, entity.Pagination{})
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "invalid sort field",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				filter := entity.ProductFilter{Sort: []entity.SortField{{Field: "price; DROP TABLE product"}}}
 
-				records, err := repo.ListProducts(context.Background())
+				_, err := repo.ListProducts(context.Background(), filter, entity.Pagination{})
+				require.ErrorIs(t, err, ErrInvalidSort)
+
+				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
-				require.Len(t, records, 1)
+			},
+		},
+		{
+			name: "cursor with custom sort",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				filter := entity.ProductFilter{Sort: []entity.SortField{{Field: "price"}}}
+				page := entity.Pagination{Cursor: &entity.Cursor{CreatedAt: createdAt, ID: 1}}
+
+				_, err := repo.ListProducts(context.Background(), filter, page)
+				require.ErrorIs(t, err, ErrCursorSort)
 
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
@@ -179,9 +339,9 @@ func TestListProduct(t *testing.T) {
 		{
 			name: "failed querying product",
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT * FROM product").WillReturnError(fmt.Errorf("error querying product"))
+				mock.ExpectQuery("SELECT * FROM product WHERE deleted_at IS NULL ORDER BY created_at, id LIMIT $1").WillReturnError(fmt.Errorf("error querying product"))
 
-				_, err := repo.ListProducts(context.Background())
+				_, err := repo.ListProducts(context.Background(), entity.ProductFilter{}, entity.Pagination{})
 				require.Error(t, err)
 
 				err = mock.ExpectationsWereMet()
@@ -201,11 +361,14 @@ func TestListProduct(t *testing.T) {
 }
 
 func TestUpdateProduct(t *testing.T) {
+	const expectUpdateProduct = "UPDATE product SET name = $3, image = $4, category = $5, description = $6, price = $7, category_id = $8, reorder_threshold = $9, version = version + 1, updated_at = now() WHERE id = $1 AND version = $2 AND deleted_at IS NULL RETURNING version, updated_at, count_in_stock"
+
 	p := &entity.Product{
 		ID:           1,
 		Name:         "test product",
 		Image:        "test.png",
 		Category:     "test category",
+		CategoryID:   3,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
@@ -215,9 +378,11 @@ func TestUpdateProduct(t *testing.T) {
 
 	np := &entity.Product{
 		ID:           1,
+		Version:      1,
 		Name:         "new test product",
 		Image:        "test.png",
 		Category:     "test category",
+		CategoryID:   3,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
@@ -232,15 +397,23 @@ func TestUpdateProduct(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				in := *np
 				// Mock the expected query and result
 				expectedID := int64(1)
 				expectedCreatedAt := time.Now()
 				expectedUpdatedAt := time.Now()
 
-				mock.ExpectQuery("INSERT INTO product (name, image, category, description, rating, num_reviews, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at").
-					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-						AddRow(expectedID, expectedCreatedAt, expectedUpdatedAt))
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO product (name, image, category, description, price, count_in_stock, category_id, reorder_threshold) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, version, created_at, updated_at").
+					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Price, p.CountInStock, p.CategoryID, p.ReorderThreshold).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at"}).
+						AddRow(expectedID, 1, expectedCreatedAt, expectedUpdatedAt))
+				mock.ExpectExec(expectInsertPrices).WithArgs(pq.Array([]int64{1})).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(expectInsertMovements(1)).
+					WithArgs(expectedID, nil, p.CountInStock, "restock", nil, "").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 
 				cp, err := repo.CreateProduct(context.Background(), p)
 				require.NoError(t, err)
@@ -248,23 +421,93 @@ func TestUpdateProduct(t *testing.T) {
 				require.Equal(t, expectedCreatedAt, cp.CreatedAt)
 				require.Equal(t, expectedUpdatedAt, cp.UpdatedAt)
 
-				mock.ExpectExec("UPDATE product SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, updated_at=? WHERE id=?").
-					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProduct).
+					WithArgs(np.ID, np.Version, np.Name, np.Image, np.Category, np.Description, np.Price, np.CategoryID, np.ReorderThreshold).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at", "count_in_stock"}).AddRow(2, expectedUpdatedAt, 10))
+				mock.ExpectExec(expectRecordPrices).WithArgs(pq.Array([]int64{1})).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
 
-				up, err := repo.UpdateProduct(context.Background(), np)
+				up, err := repo.UpdateProduct(context.Background(), &in)
 				require.NoError(t, err)
 				require.Equal(t, int64(1), up.ID)
+				require.Equal(t, int64(2), up.Version)
 				require.Equal(t, np.Name, up.Name)
 
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
 			},
 		},
+		{
+			name: "stock changed between read and update",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				// np was read with 10 in stock, 3 have been sold since
+				in := *np
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProduct).
+					WithArgs(np.ID, np.Version, np.Name, np.Image, np.Category, np.Description, np.Price, np.CategoryID, np.ReorderThreshold).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at", "count_in_stock"}).AddRow(2, time.Now(), 7))
+				mock.ExpectExec(expectRecordPrices).WithArgs(pq.Array([]int64{1})).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				// no adjustment puts the sold units back
+				up, err := repo.UpdateProduct(context.Background(), &in)
+				require.NoError(t, err)
+				require.Equal(t, int64(7), up.CountInStock)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "version conflict",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				in := *np
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProduct).
+					WithArgs(np.ID, np.Version, np.Name, np.Image, np.Category, np.Description, np.Price, np.CategoryID, np.ReorderThreshold).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at", "count_in_stock"}))
+				mock.ExpectQuery("SELECT version FROM product WHERE id=$1 AND deleted_at IS NULL").
+					WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+				mock.ExpectRollback()
+
+				_, err := repo.UpdateProduct(context.Background(), &in)
+				var conflict *VersionConflictError
+				require.ErrorAs(t, err, &conflict)
+				require.Equal(t, int64(1), conflict.Expected)
+				require.Equal(t, int64(5), conflict.Actual)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "product deleted",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				in := *np
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProduct).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at", "count_in_stock"}))
+				mock.ExpectQuery("SELECT version FROM product WHERE id=$1 AND deleted_at IS NULL").
+					WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mock.ExpectRollback()
+
+				_, err := repo.UpdateProduct(context.Background(), &in)
+				require.ErrorIs(t, err, ErrProductNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
 		{
 			name: "failed updating product",
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
-				mock.ExpectExec("UPDATE product SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, updated_at=? WHERE id=?").
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectUpdateProduct).
 					WillReturnError(fmt.Errorf("error updating product"))
+				mock.ExpectRollback()
 
 				_, err := repo.UpdateProduct(context.Background(), p)
 				require.Error(t, err)
@@ -286,6 +529,11 @@ func TestUpdateProduct(t *testing.T) {
 }
 
 func TestDeleteProduct(t *testing.T) {
+	const (
+		expectDeleteProduct          = "UPDATE product SET deleted_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL"
+		expectDeleteProductIfVersion = "UPDATE product SET deleted_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL AND version = $2"
+	)
+
 	tcs := []struct {
 		name string
 		test func(*testing.T, *ProductRepository, sqlmock.Sqlmock)
@@ -293,11 +541,41 @@ func TestDeleteProduct(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM product WHERE id=?").
-					WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(expectDeleteProduct).
+					WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				err := repo.DeleteProduct(context.Background(), 1)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "product not found",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(expectDeleteProduct).
+					WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
 
 				err := repo.DeleteProduct(context.Background(), 1)
+				require.ErrorIs(t, err, ErrProductNotFound)
+
+				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
+			},
+		},
+		{
+			name: "version conflict",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(expectDeleteProductIfVersion).
+					WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT version FROM product WHERE id=$1 AND deleted_at IS NULL").
+					WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+
+				err := repo.DeleteProductIfVersion(context.Background(), 1, 2)
+				var conflict *VersionConflictError
+				require.ErrorAs(t, err, &conflict)
+				require.Equal(t, int64(3), conflict.Actual)
 
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
@@ -306,7 +584,7 @@ func TestDeleteProduct(t *testing.T) {
 		{
 			name: "failed deleting product",
 			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM product WHERE id=?").
+				mock.ExpectExec(expectDeleteProduct).
 					WithArgs(1).WillReturnError(fmt.Errorf("error deleting product"))
 
 				err := repo.DeleteProduct(context.Background(), 1)
@@ -327,3 +605,110 @@ func TestDeleteProduct(t *testing.T) {
 		})
 	}
 }
+
+func TestRestoreProduct(t *testing.T) {
+	const expectRestoreProduct = "UPDATE product SET deleted_at = NULL, version = version + 1, updated_at = now() WHERE id = $1 AND deleted_at IS NOT NULL RETURNING *"
+	cols := []string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at", "deleted_at"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				mock.ExpectQuery(expectRestoreProduct).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "test product", "test.png", "test category", "test description", 5, 10, 1000.0, 10, now, now, nil))
+
+				p, err := repo.RestoreProduct(context.Background(), 1)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), p.ID)
+				require.Nil(t, p.DeletedAt)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "product not deleted",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(expectRestoreProduct).WithArgs(1).WillReturnRows(sqlmock.NewRows(cols))
+
+				_, err := repo.RestoreProduct(context.Background(), 1)
+				require.ErrorIs(t, err, ErrProductNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestSearchProducts(t *testing.T) {
+	cols := []string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at", "deleted_at", "rank", "headline"}
+	now := time.Now()
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(cols).
+					AddRow(1, "running shoes", "shoes.png", "shoes", "light running shoes", 5, 10, 100.0, 3, now, now, nil, 0.9, "<mark>running</mark> shoes").
+					AddRow(2, "trail shoes", "trail.png", "shoes", "shoes for running off road", 4, 2, 120.0, 1, now, now, nil, 0.4, "shoes for <mark>running</mark>")
+				mock.ExpectQuery("SELECT count(*) FROM product, websearch_to_tsquery('english', $1) query WHERE " + productSearchDocument + " @@ query AND deleted_at IS NULL").
+					WithArgs("running").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectQuery("SELECT product.*, ts_rank("+productSearchDocument+", query) AS rank, "+
+					"ts_headline('english', replace(replace(replace(name || ' ' || coalesce(description, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), "+
+					"query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2') AS headline "+
+					"FROM product, websearch_to_tsquery('english', $1) query WHERE "+productSearchDocument+" @@ query AND deleted_at IS NULL "+
+					"ORDER BY rank DESC, id LIMIT $2 OFFSET $3").
+					WithArgs("running", 10, 0).WillReturnRows(rows)
+
+				page, err := repo.SearchProducts(context.Background(), "running", entity.Pagination{Limit: 10, WithTotal: true})
+				require.NoError(t, err)
+				require.Len(t, page.Items, 2)
+				require.Equal(t, int64(2), *page.Total)
+				require.Equal(t, "running shoes", page.Items[0].Name)
+				require.Equal(t, 0.9, page.Items[0].Rank)
+				require.Equal(t, "<mark>running</mark> shoes", page.Items[0].Headline)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed searching product",
+			test: func(t *testing.T, repo *ProductRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(searchProducts).WithArgs("running", DefaultPageLimit, 20).WillReturnError(fmt.Errorf("error searching product"))
+
+				_, err := repo.SearchProducts(context.Background(), "running", entity.Pagination{Offset: 20})
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrVariantNotFound      error = apperror.NotFound("variant_not_found", "variant not found")
+	ErrSKUExists            error = apperror.Conflict("sku_exists", "a variant with this SKU already exists")
+	ErrVariantOptionsExists error = apperror.Conflict("variant_options_exist", "the product already has a variant with these options")
+)
+
+type ProductVariantRepository struct {
+	db *sqlx.DB
+}
+
+func NewProductVariantRepository(db *sqlx.DB) *ProductVariantRepository {
+	return &ProductVariantRepository{
+		db: db,
+	}
+}
+
+// variantWriteError maps the unique indexes of product_variant onto conflicts.
+func variantWriteError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation {
+		return err
+	}
+
+	if pqErr.Constraint == "product_variant_options_idx" {
+		return ErrVariantOptionsExists
+	}
+
+	return ErrSKUExists
+}
+
+// The variant is only inserted while its product exists and is not deleted.
+const insertVariant = `
+	INSERT INTO product_variant (product_id, sku, options, price, count_in_stock)
+	SELECT $1, $2, $3, $4, $5
+	WHERE EXISTS (SELECT 1 FROM product WHERE id = $1 AND deleted_at IS NULL)
+	RETURNING id, version, created_at, updated_at
+`
+
+// CreateVariant inserts the variant and records its initial stock in the
+// stock ledger.
+func (repo *ProductVariantRepository) CreateVariant(ctx context.Context, v *entity.ProductVariant) (*entity.ProductVariant, error) {
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowContext(ctx, insertVariant,
+			v.ProductID,
+			v.SKU,
+			v.Options,
+			v.Price,
+			v.CountInStock).
+			Scan(&v.ID, &v.Version, &v.CreatedAt, &v.UpdatedAt)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return variantWriteError(err)
+		}
+
+		return recordStockMovements(ctx, tx, initialStock(v.ProductID, &v.ID, v.CountInStock))
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error inserting variant: %w", err)
+	}
+
+	return v, nil
+}
+
+func (repo *ProductVariantRepository) GetVariant(ctx context.Context, productID, id int64) (*entity.ProductVariant, error) {
+	var v entity.ProductVariant
+
+	err := repo.db.GetContext(ctx, &v, "SELECT * FROM product_variant WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL", id, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error getting variant: %w", ErrVariantNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting variant: %w", err)
+	}
+
+	return &v, nil
+}
+
+func (repo *ProductVariantRepository) ListVariants(ctx context.Context, productID int64) ([]entity.ProductVariant, error) {
+	variants := []entity.ProductVariant{}
+	err := repo.db.SelectContext(ctx, &variants, "SELECT * FROM product_variant WHERE product_id = $1 AND deleted_at IS NULL ORDER BY id", productID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing variants: %w", err)
+	}
+
+	return variants, nil
+}
+
+// Like for products, count_in_stock is only changed through the stock ledger,
+// the update returns the current count.
+const updateVariant = `
+	UPDATE product_variant
+	SET sku = $4, options = $5, price = $6, version = version + 1, updated_at = now()
+	WHERE id = $1 AND product_id = $2 AND version = $3 AND deleted_at IS NULL
+	RETURNING version, updated_at, count_in_stock
+`
+
+// UpdateVariant writes the variant only if it is still at v.Version and bumps
+// the version. A concurrent modification yields a *VersionConflictError. The
+// stock is left alone, v.CountInStock is set to the current count.
+func (repo *ProductVariantRepository) UpdateVariant(ctx context.Context, v *entity.ProductVariant) (*entity.ProductVariant, error) {
+	err := repo.db.QueryRowContext(ctx, updateVariant,
+		v.ID,
+		v.ProductID,
+		v.Version,
+		v.SKU,
+		v.Options,
+		v.Price).
+		Scan(&v.Version, &v.UpdatedAt, &v.CountInStock)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repo.versionConflict(ctx, v.ProductID, v.ID, v.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating variant: %w", variantWriteError(err))
+	}
+
+	return v, nil
+}
+
+func (repo *ProductVariantRepository) versionConflict(ctx context.Context, productID, id, expected int64) error {
+	var actual int64
+	err := repo.db.GetContext(ctx, &actual, "SELECT version FROM product_variant WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL", id, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error updating variant: %w", ErrVariantNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error checking variant version: %w", err)
+	}
+
+	return &VersionConflictError{Resource: "variant", ID: id, Expected: expected, Actual: actual}
+}
+
+// DeleteVariant soft deletes the variant. Its SKU becomes available again.
+func (repo *ProductVariantRepository) DeleteVariant(ctx context.Context, productID, id int64) error {
+	res, err := repo.db.ExecContext(ctx,
+		"UPDATE product_variant SET deleted_at = now(), version = version + 1 WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL",
+		id, productID)
+	if err != nil {
+		return fmt.Errorf("error deleting variant: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting variant: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("error deleting variant: %w", ErrVariantNotFound)
+	}
+
+	return nil
+}
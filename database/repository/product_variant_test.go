@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	expectInsertVariant  = `INSERT INTO product_variant (product_id, sku, options, price, count_in_stock) SELECT $1, $2, $3, $4, $5 WHERE EXISTS (SELECT 1 FROM product WHERE id = $1 AND deleted_at IS NULL) RETURNING id, version, created_at, updated_at`
+	expectSelectVariant  = `SELECT * FROM product_variant WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL`
+	expectListVariants   = `SELECT * FROM product_variant WHERE product_id = $1 AND deleted_at IS NULL ORDER BY id`
+	expectUpdateVariant  = `UPDATE product_variant SET sku = $4, options = $5, price = $6, version = version + 1, updated_at = now() WHERE id = $1 AND product_id = $2 AND version = $3 AND deleted_at IS NULL RETURNING version, updated_at, count_in_stock`
+	expectVariantVersion = `SELECT version FROM product_variant WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL`
+	expectDeleteVariant  = `UPDATE product_variant SET deleted_at = now(), version = version + 1 WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL`
+)
+
+var variantCols = []string{"id", "version", "created_at", "updated_at", "deleted_at", "product_id", "sku", "options", "price", "count_in_stock"}
+
+func newTestVariant() *entity.ProductVariant {
+	price := 12.5
+	return &entity.ProductVariant{
+		ProductID:    1,
+		SKU:          "TS-RED-M",
+		Options:      entity.VariantOptions{"color": "red", "size": "M"},
+		Price:        &price,
+		CountInStock: 5,
+	}
+}
+
+func TestCreateVariant(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductVariantRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				v := newTestVariant()
+				now := time.Now()
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertVariant).
+					WithArgs(int64(1), "TS-RED-M", []byte(`{"color":"red","size":"M"}`), 12.5, int64(5)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at"}).AddRow(3, 1, now, now))
+				mock.ExpectExec(expectInsertMovements(1)).
+					WithArgs(int64(1), int64(3), int64(5), "restock", nil, "").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				cv, err := repo.CreateVariant(context.Background(), v)
+				require.NoError(t, err)
+				require.Equal(t, int64(3), cv.ID)
+				require.Equal(t, int64(1), cv.Version)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "product not found",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertVariant).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at"}))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateVariant(context.Background(), newTestVariant())
+				require.ErrorIs(t, err, ErrProductNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "duplicate sku",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertVariant).
+					WillReturnError(&pq.Error{Code: uniqueViolation, Constraint: "product_variant_sku_idx"})
+				mock.ExpectRollback()
+
+				_, err := repo.CreateVariant(context.Background(), newTestVariant())
+				require.ErrorIs(t, err, ErrSKUExists)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "duplicate options",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectInsertVariant).
+					WillReturnError(&pq.Error{Code: uniqueViolation, Constraint: "product_variant_options_idx"})
+				mock.ExpectRollback()
+
+				_, err := repo.CreateVariant(context.Background(), newTestVariant())
+				require.ErrorIs(t, err, ErrVariantOptionsExists)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductVariantRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestGetVariant(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductVariantRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				mock.ExpectQuery(expectSelectVariant).WithArgs(3, 1).
+					WillReturnRows(sqlmock.NewRows(variantCols).
+						AddRow(3, 1, now, now, nil, 1, "TS-RED-M", []byte(`{"color":"red","size":"M"}`), nil, 5))
+
+				v, err := repo.GetVariant(context.Background(), 1, 3)
+				require.NoError(t, err)
+				require.Equal(t, "TS-RED-M", v.SKU)
+				require.Equal(t, "red, M", v.Options.String())
+				require.Nil(t, v.Price)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(expectSelectVariant).WithArgs(3, 1).WillReturnRows(sqlmock.NewRows(variantCols))
+
+				_, err := repo.GetVariant(context.Background(), 1, 3)
+				require.ErrorIs(t, err, ErrVariantNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductVariantRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestListVariants(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductVariantRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				mock.ExpectQuery(expectListVariants).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(variantCols).
+						AddRow(3, 1, now, now, nil, 1, "TS-RED-M", []byte(`{"size":"M"}`), 12.5, 5).
+						AddRow(4, 1, now, now, nil, 1, "TS-RED-L", []byte(`{"size":"L"}`), nil, 0))
+
+				vs, err := repo.ListVariants(context.Background(), 1)
+				require.NoError(t, err)
+				require.Len(t, vs, 2)
+				require.Equal(t, 12.5, *vs[0].Price)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(expectListVariants).WithArgs(1).WillReturnError(fmt.Errorf("error listing variants"))
+
+				_, err := repo.ListVariants(context.Background(), 1)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductVariantRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestUpdateVariant(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductVariantRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				v := newTestVariant()
+				v.ID, v.Version = 3, 2
+				now := time.Now()
+				mock.ExpectQuery(expectUpdateVariant).
+					WithArgs(int64(3), int64(1), int64(2), "TS-RED-M", []byte(`{"color":"red","size":"M"}`), 12.5).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at", "count_in_stock"}).AddRow(3, now, 8))
+
+				uv, err := repo.UpdateVariant(context.Background(), v)
+				require.NoError(t, err)
+				require.Equal(t, int64(3), uv.Version)
+				// the stock changed since the variant was read, it is reported
+				// but not written back
+				require.Equal(t, int64(8), uv.CountInStock)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "version conflict",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				v := newTestVariant()
+				v.ID, v.Version = 3, 2
+				mock.ExpectQuery(expectUpdateVariant).WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at", "count_in_stock"}))
+				mock.ExpectQuery(expectVariantVersion).WithArgs(3, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+
+				_, err := repo.UpdateVariant(context.Background(), v)
+				var conflict *VersionConflictError
+				require.ErrorAs(t, err, &conflict)
+				require.Equal(t, "variant", conflict.Resource)
+				require.Equal(t, int64(4), conflict.Actual)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				v := newTestVariant()
+				v.ID, v.Version = 3, 2
+				mock.ExpectQuery(expectUpdateVariant).WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at", "count_in_stock"}))
+				mock.ExpectQuery(expectVariantVersion).WithArgs(3, 1).WillReturnRows(sqlmock.NewRows([]string{"version"}))
+
+				_, err := repo.UpdateVariant(context.Background(), v)
+				require.ErrorIs(t, err, ErrVariantNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductVariantRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestDeleteVariant(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ProductVariantRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(expectDeleteVariant).WithArgs(3, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				err := repo.DeleteVariant(context.Background(), 1, 3)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, repo *ProductVariantRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(expectDeleteVariant).WithArgs(3, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err := repo.DeleteVariant(context.Background(), 1, 3)
+				require.ErrorIs(t, err, ErrVariantNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewProductVariantRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
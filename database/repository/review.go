@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrReviewNotFound error = apperror.NotFound("review_not_found", "review not found")
+
+type ReviewRepository struct {
+	db *sqlx.DB
+}
+
+func NewReviewRepository(db *sqlx.DB) *ReviewRepository {
+	return &ReviewRepository{
+		db: db,
+	}
+}
+
+// Every write on the reviews of a product locks the product first, so that
+// concurrent writes recompute its rating one after the other.
+const lockReviewedProduct = `SELECT id FROM product WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+
+// refreshProductRating recomputes the rating, the rounded average of the
+// stars, and num_reviews from the published reviews of the product.
+const refreshProductRating = `
+	UPDATE product p SET rating = r.rating, num_reviews = r.num_reviews, version = p.version + 1, updated_at = now()
+	FROM (
+		SELECT COALESCE(ROUND(AVG(stars)), 0) AS rating, COUNT(*) AS num_reviews
+		FROM review
+		WHERE product_id = $1 AND status = 'published' AND deleted_at IS NULL
+	) r
+	WHERE p.id = $1
+`
+
+const insertReview = `
+	INSERT INTO review (product_id, author, stars, title, body, status)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at
+`
+
+const updateReview = `
+	UPDATE review SET author = $3, stars = $4, title = $5, body = $6, updated_at = now()
+	WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL
+	RETURNING created_at, updated_at, status
+`
+
+const moderateReview = `
+	UPDATE review SET status = $3, updated_at = now()
+	WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL
+	RETURNING *
+`
+
+const deleteReview = `
+	UPDATE review SET deleted_at = now()
+	WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL
+`
+
+// writeReview runs fn on the reviews of the product and refreshes the rating
+// of the product in the same transaction.
+func (repo *ReviewRepository) writeReview(ctx context.Context, productID int64, fn func(*sqlx.Tx) error) error {
+	return execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		var id int64
+		err := tx.GetContext(ctx, &id, lockReviewedProduct, productID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error locking product: %w", err)
+		}
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, refreshProductRating, productID)
+		if err != nil {
+			return fmt.Errorf("error refreshing product rating: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (repo *ReviewRepository) CreateReview(ctx context.Context, r *entity.Review) (*entity.Review, error) {
+	if r.Status == "" {
+		r.Status = entity.ReviewStatusPublished
+	}
+
+	err := repo.writeReview(ctx, r.ProductID, func(tx *sqlx.Tx) error {
+		return tx.QueryRowContext(ctx, insertReview,
+			r.ProductID,
+			r.Author,
+			r.Stars,
+			r.Title,
+			r.Body,
+			r.Status).
+			Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating review: %w", err)
+	}
+
+	return r, nil
+}
+
+func (repo *ReviewRepository) GetReview(ctx context.Context, productID, id int64) (*entity.Review, error) {
+	var r entity.Review
+
+	err := repo.db.GetContext(ctx, &r, "SELECT * FROM review WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL", id, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error getting review: %w", ErrReviewNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting review: %w", err)
+	}
+
+	return &r, nil
+}
+
+func (repo *ReviewRepository) ListReviews(ctx context.Context, productID int64, filter entity.ReviewFilter, page entity.Pagination) (*entity.Page[entity.Review], error) {
+	var where whereClause
+	where.add("product_id = ?", productID)
+	where.add("deleted_at IS NULL")
+	if filter.Status != "" {
+		where.add("status = ?", filter.Status)
+	}
+
+	reviews, err := paginate(ctx, repo.db, "review", where, "", page, reviewCursor)
+	if err != nil {
+		return nil, fmt.Errorf("error listing reviews: %w", err)
+	}
+
+	return reviews, nil
+}
+
+func reviewCursor(r entity.Review) entity.Cursor {
+	return entity.Cursor{CreatedAt: r.CreatedAt, ID: r.ID}
+}
+
+// UpdateReview edits the text and stars of the review. Its moderation status
+// is kept.
+func (repo *ReviewRepository) UpdateReview(ctx context.Context, r *entity.Review) (*entity.Review, error) {
+	err := repo.writeReview(ctx, r.ProductID, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowContext(ctx, updateReview,
+			r.ID,
+			r.ProductID,
+			r.Author,
+			r.Stars,
+			r.Title,
+			r.Body).
+			Scan(&r.CreatedAt, &r.UpdatedAt, &r.Status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrReviewNotFound
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error updating review: %w", err)
+	}
+
+	return r, nil
+}
+
+// ModerateReview publishes or rejects the review. Rejected reviews no longer
+// count towards the rating of the product.
+func (repo *ReviewRepository) ModerateReview(ctx context.Context, productID, id int64, status entity.ReviewStatus) (*entity.Review, error) {
+	var r entity.Review
+	err := repo.writeReview(ctx, productID, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &r, moderateReview, id, productID, status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrReviewNotFound
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error moderating review: %w", err)
+	}
+
+	return &r, nil
+}
+
+// DeleteReview soft deletes the review.
+func (repo *ReviewRepository) DeleteReview(ctx context.Context, productID, id int64) error {
+	err := repo.writeReview(ctx, productID, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, deleteReview, id, productID)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrReviewNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error deleting review: %w", err)
+	}
+
+	return nil
+}
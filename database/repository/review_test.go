@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	expectLockReviewedProduct = `SELECT id FROM product WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	expectRefreshRating       = `UPDATE product p SET rating = r.rating, num_reviews = r.num_reviews, version = p.version + 1, updated_at = now() FROM ( SELECT COALESCE(ROUND(AVG(stars)), 0) AS rating, COUNT(*) AS num_reviews FROM review WHERE product_id = $1 AND status = 'published' AND deleted_at IS NULL ) r WHERE p.id = $1`
+	expectInsertReview        = `INSERT INTO review (product_id, author, stars, title, body, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at`
+	expectUpdateReview        = `UPDATE review SET author = $3, stars = $4, title = $5, body = $6, updated_at = now() WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL RETURNING created_at, updated_at, status`
+	expectModerateReview      = `UPDATE review SET status = $3, updated_at = now() WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL RETURNING *`
+	expectDeleteReview        = `UPDATE review SET deleted_at = now() WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL`
+	expectListReviews         = `SELECT * FROM review WHERE product_id = $1 AND deleted_at IS NULL AND status = $2 ORDER BY created_at, id LIMIT $3`
+)
+
+var reviewCols = []string{"id", "created_at", "updated_at", "deleted_at", "product_id", "author", "stars", "title", "body", "status"}
+
+func newTestReview() *entity.Review {
+	return &entity.Review{
+		ProductID: 1,
+		Author:    "jane",
+		Stars:     4,
+		Title:     "Solid",
+		Body:      "Does what it says.",
+	}
+}
+
+func expectLockProduct(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(expectLockReviewedProduct).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
+func TestCreateReview(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ReviewRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ReviewRepository, mock sqlmock.Sqlmock) {
+				r := newTestReview()
+				now := time.Now()
+
+				mock.ExpectBegin()
+				expectLockProduct(mock)
+				mock.ExpectQuery(expectInsertReview).
+					WithArgs(int64(1), "jane", int64(4), "Solid", "Does what it says.", "published").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(5, now, now))
+				mock.ExpectExec(expectRefreshRating).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				cr, err := repo.CreateReview(context.Background(), r)
+				require.NoError(t, err)
+				require.Equal(t, int64(5), cr.ID)
+				require.Equal(t, entity.ReviewStatusPublished, cr.Status)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "product not found",
+			test: func(t *testing.T, repo *ReviewRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectLockReviewedProduct).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateReview(context.Background(), newTestReview())
+				require.ErrorIs(t, err, ErrProductNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed refreshing rating",
+			test: func(t *testing.T, repo *ReviewRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+
+				mock.ExpectBegin()
+				expectLockProduct(mock)
+				mock.ExpectQuery(expectInsertReview).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(5, now, now))
+				mock.ExpectExec(expectRefreshRating).WithArgs(1).WillReturnError(fmt.Errorf("error refreshing rating"))
+				mock.ExpectRollback()
+
+				_, err := repo.CreateReview(context.Background(), newTestReview())
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewReviewRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestListReviews(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		repo := NewReviewRepository(db)
+		now := time.Now()
+
+		mock.ExpectQuery(expectListReviews).
+			WithArgs(1, "published", DefaultPageLimit+1).
+			WillReturnRows(sqlmock.NewRows(reviewCols).
+				AddRow(5, now, now, nil, 1, "jane", 4, "Solid", "", "published").
+				AddRow(6, now, now, nil, 1, "joe", 2, "Meh", "", "published"))
+
+		page, err := repo.ListReviews(context.Background(), 1, entity.ReviewFilter{Status: entity.ReviewStatusPublished}, entity.Pagination{})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 2)
+		require.Nil(t, page.NextCursor)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestUpdateReview(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ReviewRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ReviewRepository, mock sqlmock.Sqlmock) {
+				r := newTestReview()
+				r.ID = 5
+				now := time.Now()
+
+				mock.ExpectBegin()
+				expectLockProduct(mock)
+				mock.ExpectQuery(expectUpdateReview).
+					WithArgs(int64(5), int64(1), "jane", int64(4), "Solid", "Does what it says.").
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "status"}).AddRow(now, now, "rejected"))
+				mock.ExpectExec(expectRefreshRating).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				ur, err := repo.UpdateReview(context.Background(), r)
+				require.NoError(t, err)
+				require.Equal(t, entity.ReviewStatusRejected, ur.Status)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, repo *ReviewRepository, mock sqlmock.Sqlmock) {
+				r := newTestReview()
+				r.ID = 5
+
+				mock.ExpectBegin()
+				expectLockProduct(mock)
+				mock.ExpectQuery(expectUpdateReview).WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "status"}))
+				mock.ExpectRollback()
+
+				_, err := repo.UpdateReview(context.Background(), r)
+				require.ErrorIs(t, err, ErrReviewNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewReviewRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestModerateReview(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		repo := NewReviewRepository(db)
+		now := time.Now()
+
+		mock.ExpectBegin()
+		expectLockProduct(mock)
+		mock.ExpectQuery(expectModerateReview).
+			WithArgs(5, 1, "rejected").
+			WillReturnRows(sqlmock.NewRows(reviewCols).AddRow(5, now, now, nil, 1, "jane", 1, "Spam", "", "rejected"))
+		mock.ExpectExec(expectRefreshRating).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		r, err := repo.ModerateReview(context.Background(), 1, 5, entity.ReviewStatusRejected)
+		require.NoError(t, err)
+		require.Equal(t, entity.ReviewStatusRejected, r.Status)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestDeleteReview(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *ReviewRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *ReviewRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockProduct(mock)
+				mock.ExpectExec(expectDeleteReview).WithArgs(5, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(expectRefreshRating).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := repo.DeleteReview(context.Background(), 1, 5)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, repo *ReviewRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockProduct(mock)
+				mock.ExpectExec(expectDeleteReview).WithArgs(5, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := repo.DeleteReview(context.Background(), 1, 5)
+				require.ErrorIs(t, err, ErrReviewNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewReviewRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
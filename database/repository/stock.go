@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type StockRepository struct {
+	db *sqlx.DB
+}
+
+func NewStockRepository(db *sqlx.DB) *StockRepository {
+	return &StockRepository{
+		db: db,
+	}
+}
+
+const insertStockMovement = `
+	INSERT INTO stock_movement (product_id, variant_id, delta, reason, order_id, actor)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+`
+
+// The stock never drops below zero, such a change matches no row.
+const changeProductStock = `
+	UPDATE product SET count_in_stock = count_in_stock + $2, version = version + 1, updated_at = now()
+	WHERE id = $1 AND deleted_at IS NULL AND count_in_stock + $2 >= 0
+	RETURNING count_in_stock
+`
+
+const changeVariantStock = `
+	UPDATE product_variant SET count_in_stock = count_in_stock + $3, version = version + 1, updated_at = now()
+	WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL AND count_in_stock + $3 >= 0
+	RETURNING count_in_stock
+`
+
+const selectProductStockForUpdate = `SELECT count_in_stock FROM product WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+
+const selectVariantStockForUpdate = `SELECT count_in_stock FROM product_variant WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL FOR UPDATE`
+
+// selectStockAt sums up the ledger of a product, or of one of its variants,
+// up to a point in time. created_at is a timestamptz, so the offset of the
+// point in time is kept.
+const selectStockAt = `
+	SELECT COALESCE(SUM(delta), 0) FROM stock_movement
+	WHERE product_id = $1 AND variant_id IS NOT DISTINCT FROM $2 AND created_at <= $3::timestamptz
+`
+
+// ChangeStock applies the movement to the cached count_in_stock of the
+// product or variant and appends it to the ledger in one transaction. It
+// returns the new count.
+func (repo *StockRepository) ChangeStock(ctx context.Context, m *entity.StockMovement) (int64, error) {
+	var count int64
+	err := execTx(ctx, repo.db, func(tx *sqlx.Tx) error {
+		var err error
+		count, err = changeStock(ctx, tx, m)
+		return err
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("error changing stock: %w", err)
+	}
+
+	return count, nil
+}
+
+func changeStock(ctx context.Context, tx *sqlx.Tx, m *entity.StockMovement) (int64, error) {
+	var count int64
+	var err error
+	if m.VariantID == nil {
+		err = tx.GetContext(ctx, &count, changeProductStock, m.ProductID, m.Delta)
+	} else {
+		err = tx.GetContext(ctx, &count, changeVariantStock, *m.VariantID, m.ProductID, m.Delta)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, stockChangeError(ctx, tx, m)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error updating stock: %w", err)
+	}
+
+	if err := recordStockMovement(ctx, tx, m); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// stockChangeError explains why a stock change matched no row: either the
+// product or variant is gone or there is not enough stock.
+func stockChangeError(ctx context.Context, tx *sqlx.Tx, m *entity.StockMovement) error {
+	var available int64
+	var err error
+	if m.VariantID == nil {
+		err = tx.GetContext(ctx, &available, selectProductStockForUpdate, m.ProductID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
+	} else {
+		err = tx.GetContext(ctx, &available, selectVariantStockForUpdate, *m.VariantID, m.ProductID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVariantNotFound
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error checking stock: %w", err)
+	}
+
+	return &OutOfStockError{ProductID: m.ProductID, VariantID: m.VariantID, Requested: -m.Delta, Available: available}
+}
+
+func recordStockMovement(ctx context.Context, tx *sqlx.Tx, m *entity.StockMovement) error {
+	err := tx.QueryRowContext(ctx, insertStockMovement,
+		m.ProductID,
+		m.VariantID,
+		m.Delta,
+		m.Reason,
+		m.OrderID,
+		m.Actor).
+		Scan(&m.ID, &m.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("error inserting stock movement: %w", err)
+	}
+
+	return nil
+}
+
+// recordStockMovements appends movements whose change has already been applied
+// to the cached counts, using multi-row INSERT statements.
+func recordStockMovements(ctx context.Context, tx *sqlx.Tx, ms []*entity.StockMovement) error {
+	if len(ms) == 0 {
+		return nil
+	}
+
+	types := []string{"int", "int", "int", "varchar", "int", "varchar"}
+	for _, chunk := range chunks(ms, bulkChunkSize) {
+		args := make([]interface{}, 0, len(chunk)*len(types))
+		for _, m := range chunk {
+			args = append(args, m.ProductID, m.VariantID, m.Delta, m.Reason, m.OrderID, m.Actor)
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO stock_movement (product_id, variant_id, delta, reason, order_id, actor) VALUES `+
+			valuesRows(len(chunk), types), args...)
+		if err != nil {
+			return fmt.Errorf("error inserting stock movements: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// initialStock returns the movement that records the stock of a new product
+// or variant, none when it starts out of stock.
+func initialStock(productID int64, variantID *int64, count int64) []*entity.StockMovement {
+	if count == 0 {
+		return nil
+	}
+
+	return []*entity.StockMovement{{
+		ProductID: productID,
+		VariantID: variantID,
+		Delta:     count,
+		Reason:    entity.StockReasonRestock,
+	}}
+}
+
+// StockAt reconstructs the stock of the product, or of one of its variants,
+// at the given time from the ledger.
+func (repo *StockRepository) StockAt(ctx context.Context, productID int64, variantID *int64, at time.Time) (int64, error) {
+	var count int64
+	err := repo.db.GetContext(ctx, &count, selectStockAt, productID, variantID, at)
+	if err != nil {
+		return 0, fmt.Errorf("error getting stock: %w", err)
+	}
+
+	return count, nil
+}
+
+// ListStockMovements returns one page of the ledger of the product, oldest
+// first. With variantID set only the movements of that variant are listed.
+func (repo *StockRepository) ListStockMovements(ctx context.Context, productID int64, variantID *int64, page entity.Pagination) (*entity.Page[entity.StockMovement], error) {
+	var where whereClause
+	where.add("product_id = ?", productID)
+	if variantID != nil {
+		where.add("variant_id = ?", *variantID)
+	}
+
+	movements, err := paginate(ctx, repo.db, "stock_movement", where, "", page, stockMovementCursor)
+	if err != nil {
+		return nil, fmt.Errorf("error listing stock movements: %w", err)
+	}
+
+	return movements, nil
+}
+
+func stockMovementCursor(m entity.StockMovement) entity.Cursor {
+	return entity.Cursor{CreatedAt: m.CreatedAt, ID: m.ID}
+}
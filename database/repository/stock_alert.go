@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type StockAlertRepository struct {
+	db *sqlx.DB
+}
+
+func NewStockAlertRepository(db *sqlx.DB) *StockAlertRepository {
+	return &StockAlertRepository{
+		db: db,
+	}
+}
+
+// openStockAlerts raises an alert for every product below its reorder
+// threshold. Products that already have an open alert are skipped by the
+// partial unique index on product_id.
+const openStockAlerts = `
+	INSERT INTO stock_alert (product_id, count_in_stock, reorder_threshold)
+	SELECT id, count_in_stock, reorder_threshold FROM product
+	WHERE deleted_at IS NULL AND count_in_stock < reorder_threshold
+	ON CONFLICT (product_id) WHERE resolved_at IS NULL DO NOTHING
+`
+
+// resolveStockAlerts resolves the open alerts of products that are back at
+// their reorder threshold or deleted.
+const resolveStockAlerts = `
+	UPDATE stock_alert a SET resolved_at = now()
+	FROM product p
+	WHERE p.id = a.product_id AND a.resolved_at IS NULL
+		AND (p.count_in_stock >= p.reorder_threshold OR p.deleted_at IS NOT NULL)
+`
+
+// OpenStockAlerts raises the alerts of the products that fell below their
+// reorder threshold and returns how many were raised.
+func (repo *StockAlertRepository) OpenStockAlerts(ctx context.Context) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, openStockAlerts)
+	if err != nil {
+		return 0, fmt.Errorf("error opening stock alerts: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error opening stock alerts: %w", err)
+	}
+
+	return n, nil
+}
+
+// ResolveStockAlerts resolves the alerts of products that were restocked and
+// returns how many were resolved.
+func (repo *StockAlertRepository) ResolveStockAlerts(ctx context.Context) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, resolveStockAlerts)
+	if err != nil {
+		return 0, fmt.Errorf("error resolving stock alerts: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error resolving stock alerts: %w", err)
+	}
+
+	return n, nil
+}
+
+// PendingStockAlerts returns the open alerts nobody has been notified about
+// yet, oldest first.
+func (repo *StockAlertRepository) PendingStockAlerts(ctx context.Context) ([]entity.StockAlert, error) {
+	alerts := []entity.StockAlert{}
+	err := repo.db.SelectContext(ctx, &alerts, "SELECT * FROM stock_alert WHERE notified_at IS NULL AND resolved_at IS NULL ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("error getting pending stock alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+func (repo *StockAlertRepository) MarkStockAlertNotified(ctx context.Context, id int64) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE stock_alert SET notified_at = now() WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("error marking stock alert notified: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *StockAlertRepository) ListStockAlerts(ctx context.Context, filter entity.StockAlertFilter, page entity.Pagination) (*entity.Page[entity.StockAlert], error) {
+	var where whereClause
+	switch filter.Status {
+	case entity.StockAlertStatusOpen:
+		where.add("resolved_at IS NULL")
+	case entity.StockAlertStatusResolved:
+		where.add("resolved_at IS NOT NULL")
+	}
+	if filter.ProductID != nil {
+		where.add("product_id = ?", *filter.ProductID)
+	}
+
+	alerts, err := paginate(ctx, repo.db, "stock_alert", where, "", page, stockAlertCursor)
+	if err != nil {
+		return nil, fmt.Errorf("error listing stock alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+func stockAlertCursor(a entity.StockAlert) entity.Cursor {
+	return entity.Cursor{CreatedAt: a.CreatedAt, ID: a.ID}
+}
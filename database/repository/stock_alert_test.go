@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	expectOpenStockAlerts    = `INSERT INTO stock_alert (product_id, count_in_stock, reorder_threshold) SELECT id, count_in_stock, reorder_threshold FROM product WHERE deleted_at IS NULL AND count_in_stock < reorder_threshold ON CONFLICT (product_id) WHERE resolved_at IS NULL DO NOTHING`
+	expectResolveStockAlerts = `UPDATE stock_alert a SET resolved_at = now() FROM product p WHERE p.id = a.product_id AND a.resolved_at IS NULL AND (p.count_in_stock >= p.reorder_threshold OR p.deleted_at IS NOT NULL)`
+	expectPendingStockAlerts = `SELECT * FROM stock_alert WHERE notified_at IS NULL AND resolved_at IS NULL ORDER BY created_at, id`
+)
+
+var stockAlertCols = []string{"id", "created_at", "product_id", "count_in_stock", "reorder_threshold", "notified_at", "resolved_at"}
+
+func TestOpenStockAlerts(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *StockAlertRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, repo *StockAlertRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(expectOpenStockAlerts).WillReturnResult(sqlmock.NewResult(0, 2))
+
+				n, err := repo.OpenStockAlerts(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, int64(2), n)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed",
+			test: func(t *testing.T, repo *StockAlertRepository, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(expectOpenStockAlerts).WillReturnError(fmt.Errorf("error opening stock alerts"))
+
+				_, err := repo.OpenStockAlerts(context.Background())
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewStockAlertRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestResolveStockAlerts(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		repo := NewStockAlertRepository(db)
+		mock.ExpectExec(expectResolveStockAlerts).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		n, err := repo.ResolveStockAlerts(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestPendingStockAlerts(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		repo := NewStockAlertRepository(db)
+		now := time.Now()
+
+		mock.ExpectQuery(expectPendingStockAlerts).
+			WillReturnRows(sqlmock.NewRows(stockAlertCols).AddRow(4, now, 1, 2, 5, nil, nil))
+		mock.ExpectExec("UPDATE stock_alert SET notified_at = now() WHERE id = $1").
+			WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		alerts, err := repo.PendingStockAlerts(context.Background())
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+		require.Equal(t, int64(2), alerts[0].CountInStock)
+		require.Equal(t, int64(5), alerts[0].ReorderThreshold)
+
+		err = repo.MarkStockAlertNotified(context.Background(), alerts[0].ID)
+		require.NoError(t, err)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestListStockAlerts(t *testing.T) {
+	productID := int64(1)
+
+	tcs := []struct {
+		name   string
+		filter entity.StockAlertFilter
+		query  string
+		args   []driver.Value
+	}{
+		{
+			name:  "all",
+			query: `SELECT * FROM stock_alert ORDER BY created_at, id LIMIT $1`,
+			args:  []driver.Value{21},
+		},
+		{
+			name:   "open",
+			filter: entity.StockAlertFilter{Status: entity.StockAlertStatusOpen},
+			query:  `SELECT * FROM stock_alert WHERE resolved_at IS NULL ORDER BY created_at, id LIMIT $1`,
+			args:   []driver.Value{21},
+		},
+		{
+			name:   "resolved for product",
+			filter: entity.StockAlertFilter{Status: entity.StockAlertStatusResolved, ProductID: &productID},
+			query:  `SELECT * FROM stock_alert WHERE resolved_at IS NOT NULL AND product_id = $1 ORDER BY created_at, id LIMIT $2`,
+			args:   []driver.Value{1, 21},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewStockAlertRepository(db)
+				now := time.Now()
+
+				mock.ExpectQuery(tc.query).WithArgs(tc.args...).
+					WillReturnRows(sqlmock.NewRows(stockAlertCols).AddRow(4, now, 1, 2, 5, now, nil))
+
+				page, err := repo.ListStockAlerts(context.Background(), tc.filter, entity.Pagination{})
+				require.NoError(t, err)
+				require.Len(t, page.Items, 1)
+				require.Nil(t, page.NextCursor)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	expectChangeProductStock = `UPDATE product SET count_in_stock = count_in_stock + $2, version = version + 1, updated_at = now() WHERE id = $1 AND deleted_at IS NULL AND count_in_stock + $2 >= 0 RETURNING count_in_stock`
+	expectChangeVariantStock = `UPDATE product_variant SET count_in_stock = count_in_stock + $3, version = version + 1, updated_at = now() WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL AND count_in_stock + $3 >= 0 RETURNING count_in_stock`
+	expectLockProductStock   = `SELECT count_in_stock FROM product WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	expectInsertMovement     = `INSERT INTO stock_movement (product_id, variant_id, delta, reason, order_id, actor) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	expectStockAt            = `SELECT COALESCE(SUM(delta), 0) FROM stock_movement WHERE product_id = $1 AND variant_id IS NOT DISTINCT FROM $2 AND created_at <= $3::timestamptz`
+)
+
+// expectInsertMovements is the multi-row insert of n stock movements.
+func expectInsertMovements(n int) string {
+	return `INSERT INTO stock_movement (product_id, variant_id, delta, reason, order_id, actor) VALUES ` +
+		valuesRows(n, []string{"int", "int", "int", "varchar", "int", "varchar"})
+}
+
+func TestChangeStock(t *testing.T) {
+	variantID := int64(7)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *StockRepository, sqlmock.Sqlmock)
+	}{
+		{
+			name: "restock",
+			test: func(t *testing.T, repo *StockRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				m := &entity.StockMovement{ProductID: 1, Delta: 5, Reason: entity.StockReasonRestock, Actor: "jane"}
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectChangeProductStock).WithArgs(1, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}).AddRow(15))
+				mock.ExpectQuery(expectInsertMovement).
+					WithArgs(int64(1), nil, int64(5), "restock", nil, "jane").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, now))
+				mock.ExpectCommit()
+
+				count, err := repo.ChangeStock(context.Background(), m)
+				require.NoError(t, err)
+				require.Equal(t, int64(15), count)
+				require.Equal(t, int64(3), m.ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "variant",
+			test: func(t *testing.T, repo *StockRepository, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				m := &entity.StockMovement{ProductID: 1, VariantID: &variantID, Delta: -2, Reason: entity.StockReasonAdjustment}
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectChangeVariantStock).WithArgs(7, 1, -2).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}).AddRow(3))
+				mock.ExpectQuery(expectInsertMovement).
+					WithArgs(int64(1), int64(7), int64(-2), "adjustment", nil, "").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(4, now))
+				mock.ExpectCommit()
+
+				count, err := repo.ChangeStock(context.Background(), m)
+				require.NoError(t, err)
+				require.Equal(t, int64(3), count)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not enough stock",
+			test: func(t *testing.T, repo *StockRepository, mock sqlmock.Sqlmock) {
+				m := &entity.StockMovement{ProductID: 1, Delta: -5, Reason: entity.StockReasonAdjustment}
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectChangeProductStock).WithArgs(1, -5).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}))
+				mock.ExpectQuery(expectLockProductStock).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}).AddRow(2))
+				mock.ExpectRollback()
+
+				_, err := repo.ChangeStock(context.Background(), m)
+				var outOfStock *OutOfStockError
+				require.True(t, errors.As(err, &outOfStock))
+				require.Equal(t, int64(5), outOfStock.Requested)
+				require.Equal(t, int64(2), outOfStock.Available)
+				require.ErrorIs(t, err, apperror.ErrOutOfStock)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "product not found",
+			test: func(t *testing.T, repo *StockRepository, mock sqlmock.Sqlmock) {
+				m := &entity.StockMovement{ProductID: 1, Delta: 5, Reason: entity.StockReasonRestock}
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectChangeProductStock).WithArgs(1, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}))
+				mock.ExpectQuery(expectLockProductStock).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}))
+				mock.ExpectRollback()
+
+				_, err := repo.ChangeStock(context.Background(), m)
+				require.ErrorIs(t, err, ErrProductNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewStockRepository(db)
+				tc.test(t, repo, mock)
+			})
+		})
+	}
+}
+
+func TestStockAt(t *testing.T) {
+	tcs := []struct {
+		name string
+		at   time.Time
+	}{
+		{
+			name: "utc",
+			at:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// the offset has to reach the database, which compares the
+			// instants
+			name: "non-utc offset",
+			at:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.FixedZone("", -5*60*60)),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				repo := NewStockRepository(db)
+
+				mock.ExpectQuery(expectStockAt).WithArgs(1, nil, tc.at).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(8))
+
+				count, err := repo.StockAt(context.Background(), 1, nil, tc.at)
+				require.NoError(t, err)
+				require.Equal(t, int64(8), count)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestListStockMovements(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		repo := NewStockRepository(db)
+		now := time.Now()
+
+		mock.ExpectQuery(`SELECT * FROM stock_movement WHERE product_id = $1 ORDER BY created_at, id LIMIT $2`).
+			WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "product_id", "variant_id", "delta", "reason", "order_id", "actor"}).
+				AddRow(1, now, 1, nil, 10, "restock", nil, "").
+				AddRow(2, now, 1, nil, -1, "sale", 4, ""))
+
+		page, err := repo.ListStockMovements(context.Background(), 1, nil, entity.Pagination{Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		require.NotNil(t, page.NextCursor)
+		require.Equal(t, int64(1), page.NextCursor.ID)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
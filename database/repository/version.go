@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"chi-sqlx/apperror"
+	"fmt"
+)
+
+// VersionConflictError is returned when a conditional write finds the row at
+// a different version than the caller read.
+type VersionConflictError struct {
+	Resource string
+	ID       int64
+	Expected int64
+	Actual   int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s %d was modified: expected version %d, found %d", e.Resource, e.ID, e.Expected, e.Actual)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return apperror.Conflict("version_conflict", e.Error())
+}
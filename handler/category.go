@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type categoryHandler struct {
+	service *service.CategoryService
+}
+
+func NewCategoryController(service *service.CategoryService) *categoryHandler {
+	return &categoryHandler{
+		service: service,
+	}
+}
+
+func toStoreCategory(c entity.CategoryReq) *entity.Category {
+	return &entity.Category{
+		ParentID: c.ParentID,
+		Name:     c.Name,
+		Slug:     c.Slug,
+	}
+}
+
+func toCategoryRes(c *entity.Category) entity.CategoryRes {
+	return entity.CategoryRes{
+		ID:        c.ID,
+		ParentID:  c.ParentID,
+		Name:      c.Name,
+		Slug:      c.Slug,
+		Path:      c.Path,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+// toCategoryTree nests the categories below their parents. The roots are the
+// categories without parent, or the category with ID root.
+func toCategoryTree(categories []entity.Category, root *int64) []entity.CategoryTreeRes {
+	children := make(map[int64][]*entity.Category)
+	var roots []*entity.Category
+	for i := range categories {
+		c := &categories[i]
+		switch {
+		case root != nil && c.ID == *root:
+			roots = append(roots, c)
+		case root == nil && c.ParentID == nil:
+			roots = append(roots, c)
+		}
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+
+	var build func([]*entity.Category) []entity.CategoryTreeRes
+	build = func(cs []*entity.Category) []entity.CategoryTreeRes {
+		res := make([]entity.CategoryTreeRes, 0, len(cs))
+		for _, c := range cs {
+			res = append(res, entity.CategoryTreeRes{
+				CategoryRes: toCategoryRes(c),
+				Children:    build(children[c.ID]),
+			})
+		}
+		return res
+	}
+
+	return build(roots)
+}
+
+func (h *categoryHandler) createCategory(w http.ResponseWriter, r *http.Request) {
+	var c entity.CategoryReq
+	if err := decodeAndValidate(w, r, &c); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	category, err := h.service.CreateCategory(r.Context(), toStoreCategory(c))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toCategoryRes(category)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *categoryHandler) getCategory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	category, err := h.service.GetCategory(r.Context(), i)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toCategoryRes(category)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *categoryHandler) listCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.service.ListCategories(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := make([]entity.CategoryRes, 0, len(categories))
+	for i := range categories {
+		res = append(res, toCategoryRes(&categories[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// categoryTree returns the whole category tree, or with ?root=ID the subtree
+// of that category.
+func (h *categoryHandler) categoryTree(w http.ResponseWriter, r *http.Request) {
+	var root *int64
+	if v := r.URL.Query().Get("root"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, r, badRequest("invalid root "+strconv.Quote(v)))
+			return
+		}
+		root = &id
+	}
+
+	categories, err := h.service.ListCategories(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toCategoryTree(categories, root)
+	if root != nil && len(res) == 0 {
+		_, err := h.service.GetCategory(r.Context(), *root)
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *categoryHandler) updateCategory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	var c entity.CategoryReq
+	if err := decodeAndValidate(w, r, &c); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	category := toStoreCategory(c)
+	category.ID = i
+	category, err = h.service.UpdateCategory(r.Context(), category)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toCategoryRes(category)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *categoryHandler) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	if err := h.service.DeleteCategory(r.Context(), i); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/validation"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxBodyBytes caps the size of a JSON request body.
+const maxBodyBytes = 1 << 20
+
+// limitBody stops reading the request body after maxBodyBytes.
+func limitBody(w http.ResponseWriter, r *http.Request) io.Reader {
+	return http.MaxBytesReader(w, r.Body, maxBodyBytes)
+}
+
+// decodeJSON strictly decodes the request body into v: the body must be a
+// single JSON value no larger than maxBodyBytes without unknown fields.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return decodeStrict(limitBody(w, r), v)
+}
+
+// decodeAndValidate decodes the request body into v and checks it against
+// its validation rules.
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if err := decodeJSON(w, r, v); err != nil {
+		return err
+	}
+
+	return validation.Struct(v)
+}
+
+func decodeStrict(body io.Reader, v interface{}) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return decodeError(err)
+		}
+		return badRequest("request body must contain a single JSON value")
+	}
+
+	return nil
+}
+
+// decodeError describes why a body could not be decoded.
+func decodeError(err error) error {
+	var tooLarge *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &requestError{
+			status:  http.StatusRequestEntityTooLarge,
+			code:    "payload_too_large",
+			message: fmt.Sprintf("request body must not be larger than %d bytes", tooLarge.Limit),
+		}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return apperror.Validation("invalid_type", "request body has a field of the wrong type",
+			apperror.FieldError{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()})
+	case errors.As(err, &syntaxErr):
+		return badRequest(fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.Is(err, io.EOF):
+		return badRequest("request body must not be empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return badRequest("malformed JSON")
+	default:
+		// unknown fields and wrong top level types
+		return badRequest(err.Error())
+	}
+}
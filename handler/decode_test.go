@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type req struct {
+		Name  string `json:"name"`
+		Price int64  `json:"price"`
+	}
+
+	tcs := []struct {
+		name    string
+		body    string
+		want    req
+		status  int
+		code    string
+		message string
+	}{
+		{
+			name: "valid",
+			body: `{"name": "hammer", "price": 5}`,
+			want: req{Name: "hammer", Price: 5},
+		},
+		{
+			name: "trailing whitespace",
+			body: "{\"name\": \"hammer\"}\n  ",
+			want: req{Name: "hammer"},
+		},
+		{
+			name:    "unknown field",
+			body:    `{"name": "hammer", "colour": "red"}`,
+			status:  http.StatusBadRequest,
+			code:    "bad_request",
+			message: `json: unknown field "colour"`,
+		},
+		{
+			name:    "trailing data",
+			body:    `{"name": "hammer"} {"name": "saw"}`,
+			status:  http.StatusBadRequest,
+			code:    "bad_request",
+			message: "request body must contain a single JSON value",
+		},
+		{
+			name:    "trailing garbage",
+			body:    `{"name": "hammer"}x`,
+			status:  http.StatusBadRequest,
+			code:    "bad_request",
+			message: "request body must contain a single JSON value",
+		},
+		{
+			name:    "empty body",
+			body:    ``,
+			status:  http.StatusBadRequest,
+			code:    "bad_request",
+			message: "request body must not be empty",
+		},
+		{
+			name:    "truncated",
+			body:    `{"name": "ham`,
+			status:  http.StatusBadRequest,
+			code:    "bad_request",
+			message: "malformed JSON",
+		},
+		{
+			name:    "syntax error",
+			body:    `{"name": hammer}`,
+			status:  http.StatusBadRequest,
+			code:    "bad_request",
+			message: "malformed JSON at offset 10",
+		},
+		{
+			name:    "wrong type",
+			body:    `{"price": "cheap"}`,
+			status:  http.StatusUnprocessableEntity,
+			code:    "invalid_type",
+			message: "request body has a field of the wrong type",
+		},
+		{
+			name:    "over the limit",
+			body:    `{"name": "` + strings.Repeat("a", maxBodyBytes) + `"}`,
+			status:  http.StatusRequestEntityTooLarge,
+			code:    "payload_too_large",
+			message: "request body must not be larger than 1048576 bytes",
+		},
+		{
+			name:    "over the limit after the value",
+			body:    `{"name": "hammer"}` + strings.Repeat(" ", maxBodyBytes),
+			status:  http.StatusRequestEntityTooLarge,
+			code:    "payload_too_large",
+			message: "request body must not be larger than 1048576 bytes",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/product", strings.NewReader(tc.body))
+
+			var got req
+			err := decodeJSON(httptest.NewRecorder(), r, &got)
+			if tc.status == 0 {
+				require.NoError(t, err)
+				require.Equal(t, tc.want, got)
+				return
+			}
+
+			status, body := toErrorBody(context.Background(), err)
+			require.Equal(t, tc.status, status)
+			require.Equal(t, tc.code, body.Code)
+			require.Equal(t, tc.message, body.Message)
+		})
+	}
+}
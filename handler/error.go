@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// requestError is a failure detected by the HTTP layer itself, before the
+// request reaches a service, such as an unparsable ID or body.
+type requestError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(message string) error {
+	return &requestError{status: http.StatusBadRequest, code: "bad_request", message: message}
+}
+
+// statusOf maps a domain error kind onto its HTTP status.
+func statusOf(kind error) int {
+	switch kind {
+	case apperror.ErrNotFound:
+		return http.StatusNotFound
+	case apperror.ErrConflict, apperror.ErrOutOfStock:
+		return http.StatusConflict
+	case apperror.ErrValidation:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// toErrorBody describes err for the client. Domain and request errors are
+// reported as they are, anything else is logged and hidden behind a generic
+// internal error.
+func toErrorBody(ctx context.Context, err error) (int, entity.ErrorBody) {
+	var reqErr *requestError
+	var appErr *apperror.Error
+	switch {
+	case errors.As(err, &reqErr):
+		return reqErr.status, entity.ErrorBody{Code: reqErr.code, Message: reqErr.message}
+	case errors.As(err, &appErr):
+		return statusOf(appErr.Kind), entity.ErrorBody{Code: appErr.Code, Message: appErr.Message, Fields: appErr.Fields}
+	default:
+		slog.ErrorContext(ctx, "internal error", "error", err)
+		return http.StatusInternalServerError, entity.ErrorBody{Code: "internal_error", Message: "internal server error"}
+	}
+}
+
+// writeError is the single place where errors become HTTP responses.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, body := toErrorBody(r.Context(), err)
+	body.RequestID = middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(entity.ErrorRes{Error: body})
+}
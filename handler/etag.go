@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"chi-sqlx/database/repository"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag returns the strong entity tag for a resource version. Every write that
+// changes the representation of a product or variant bumps its version, stock
+// and rating changes included, so a tag always stands for one representation.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// checkIfMatch evaluates the If-Match header against the current version using
+// strong comparison. present is false when the request carries no If-Match,
+// in which case the write is unconditional from the client's point of view.
+func checkIfMatch(r *http.Request, version int64) (matched bool, present bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return false, false
+	}
+
+	if header == "*" {
+		return true, true
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true, true
+		}
+	}
+
+	return false, true
+}
+
+func preconditionFailed(resource string) error {
+	return &requestError{
+		status:  http.StatusPreconditionFailed,
+		code:    "precondition_failed",
+		message: resource + " has been modified",
+	}
+}
+
+// versionConflict turns a lost update into 412 Precondition Failed for clients
+// that sent If-Match. Everyone else gets the plain 409 Conflict.
+func versionConflict(err error, conditional bool) error {
+	var conflict *repository.VersionConflictError
+	if conditional && errors.As(err, &conflict) {
+		return preconditionFailed(conflict.Resource)
+	}
+
+	return err
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	tcs := []struct {
+		name        string
+		header      string
+		matched     bool
+		conditional bool
+	}{
+		{name: "no header"},
+		{name: "blank header", header: "  "},
+		{name: "any", header: "*", matched: true, conditional: true},
+		{name: "strong match", header: `"3"`, matched: true, conditional: true},
+		{name: "strong mismatch", header: `"2"`, conditional: true},
+		// If-Match uses strong comparison, so weak tags never match
+		{name: "weak tag", header: `W/"3"`, conditional: true},
+		{name: "list with match", header: `"1", "3"`, matched: true, conditional: true},
+		{name: "list without spaces", header: `"1","3"`, matched: true, conditional: true},
+		{name: "list without match", header: `"1", W/"3"`, conditional: true},
+		{name: "unquoted tag", header: `3`, conditional: true},
+		{name: "unterminated tag", header: `"3`, conditional: true},
+		{name: "empty list entries", header: `,,`, conditional: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/product/1", nil)
+			if tc.header != "" {
+				r.Header.Set("If-Match", tc.header)
+			}
+
+			matched, conditional := checkIfMatch(r, 3)
+			require.Equal(t, tc.matched, matched)
+			require.Equal(t, tc.conditional, conditional)
+		})
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	conflict := &repository.VersionConflictError{Resource: "product", ID: 1, Expected: 2, Actual: 3}
+	other := errors.New("database is down")
+
+	tcs := []struct {
+		name        string
+		err         error
+		conditional bool
+		status      int
+	}{
+		{name: "conditional conflict", err: conflict, conditional: true, status: http.StatusPreconditionFailed},
+		{name: "wrapped conditional conflict", err: fmt.Errorf("error updating product: %w", conflict), conditional: true, status: http.StatusPreconditionFailed},
+		{name: "unconditional conflict", err: conflict, status: http.StatusConflict},
+		{name: "conditional other error", err: other, conditional: true, status: http.StatusInternalServerError},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := versionConflict(tc.err, tc.conditional)
+
+			status, body := toErrorBody(context.Background(), err)
+			require.Equal(t, tc.status, status)
+			if tc.status == http.StatusPreconditionFailed {
+				require.Equal(t, "precondition_failed", body.Code)
+				require.Equal(t, "product has been modified", body.Message)
+				return
+			}
+			require.ErrorIs(t, err, tc.err)
+			if tc.status == http.StatusConflict {
+				require.ErrorIs(t, err, apperror.ErrConflict)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"bufio"
+	"chi-sqlx/database/entity"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	contentTypeCSV    = "text/csv"
+	contentTypeNDJSON = "application/x-ndjson"
+
+	// exportFlushRows is the number of rows after which an export is flushed
+	// to the client.
+	exportFlushRows = 1000
+)
+
+type exportFormat string
+
+const (
+	exportCSV    exportFormat = "csv"
+	exportNDJSON exportFormat = "ndjson"
+)
+
+var errNotAcceptable error = &requestError{
+	status:  http.StatusNotAcceptable,
+	code:    "not_acceptable",
+	message: "export is only available as text/csv or application/x-ndjson",
+}
+
+// parseExportFormat takes the format from the format query parameter or else
+// negotiates it from the Accept header. CSV is the default.
+func parseExportFormat(r *http.Request) (exportFormat, error) {
+	switch v := r.URL.Query().Get("format"); v {
+	case "":
+	case string(exportCSV), string(exportNDJSON):
+		return exportFormat(v), nil
+	default:
+		return "", badRequest(fmt.Sprintf("invalid format %q", v))
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return exportCSV, nil
+	}
+
+	var format exportFormat
+	best := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= best {
+			continue
+		}
+
+		switch mediaType {
+		case contentTypeCSV, "text/*", "*/*":
+			format, best = exportCSV, q
+		case contentTypeNDJSON, "application/ndjson", "application/jsonl":
+			format, best = exportNDJSON, q
+		}
+	}
+
+	if format == "" {
+		return "", errNotAcceptable
+	}
+
+	return format, nil
+}
+
+// exportWriter streams rows to the client. Nothing is written until the first
+// row, so that an error before that still gets a proper error response.
+type exportWriter[T any] struct {
+	w       http.ResponseWriter
+	format  exportFormat
+	name    string
+	header  []string
+	record  func(*T) []string
+	res     func(*T) interface{}
+	started bool
+	rows    int
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	json    *json.Encoder
+}
+
+func (e *exportWriter[T]) start() error {
+	e.started = true
+
+	// an export streams for as long as it takes, not bounded by the server's
+	// write timeout
+	_ = http.NewResponseController(e.w).SetWriteDeadline(time.Time{})
+
+	contentType, ext := contentTypeCSV, "csv"
+	if e.format == exportNDJSON {
+		contentType, ext = contentTypeNDJSON, "ndjson"
+	}
+	e.w.Header().Set("Content-Type", contentType)
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, e.name, ext))
+	e.w.WriteHeader(http.StatusOK)
+
+	e.buf = bufio.NewWriter(e.w)
+	if e.format == exportNDJSON {
+		e.json = json.NewEncoder(e.buf)
+		return nil
+	}
+
+	e.csv = csv.NewWriter(e.buf)
+	return e.csv.Write(e.header)
+}
+
+func (e *exportWriter[T]) write(v *T) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if e.format == exportNDJSON {
+		err = e.json.Encode(e.res(v))
+	} else {
+		err = e.csv.Write(e.record(v))
+	}
+	if err != nil {
+		return err
+	}
+
+	e.rows++
+	if e.rows%exportFlushRows == 0 {
+		return e.flush()
+	}
+
+	return nil
+}
+
+func (e *exportWriter[T]) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := e.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// finish completes the export after the last row. Once rows have been sent
+// the status cannot change anymore, so a late error only cuts the export short.
+func (e *exportWriter[T]) finish(r *http.Request, err error) {
+	if err != nil && !e.started {
+		writeError(e.w, r, err)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "export aborted", "error", err)
+	}
+
+	if !e.started {
+		if err := e.start(); err != nil {
+			slog.ErrorContext(r.Context(), "export aborted", "error", err)
+			return
+		}
+	}
+	if err := e.flush(); err != nil {
+		slog.ErrorContext(r.Context(), "export aborted", "error", err)
+	}
+}
+
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+var productCSVHeader = []string{
+	"id", "version", "created_at", "updated_at", "deleted_at", "name", "image",
+	"category", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock",
+	"reorder_threshold",
+}
+
+func productCSVRecord(p *entity.Product) []string {
+	return []string{
+		strconv.FormatInt(p.ID, 10),
+		strconv.FormatInt(p.Version, 10),
+		formatCSVTime(&p.CreatedAt),
+		formatCSVTime(&p.UpdatedAt),
+		formatCSVTime(p.DeletedAt),
+		p.Name,
+		p.Image,
+		p.Category,
+		strconv.FormatInt(p.CategoryID, 10),
+		p.Description,
+		strconv.FormatInt(p.Rating, 10),
+		strconv.FormatInt(p.NumReviews, 10),
+		strconv.FormatFloat(p.Price, 'f', 2, 64),
+		strconv.FormatInt(p.CountInStock, 10),
+		strconv.FormatInt(p.ReorderThreshold, 10),
+	}
+}
+
+var orderCSVHeader = []string{
+	"id", "version", "created_at", "updated_at", "deleted_at", "status",
+	"payment_method", "tax_price", "shipping_price", "total_price", "items",
+}
+
+// orderCSVRecord writes the items of the order as a JSON array into a single
+// column, so that every order stays one CSV row.
+func orderCSVRecord(o *entity.Order) []string {
+	res := toOrderRes(o)
+	items, _ := json.Marshal(res.Items)
+
+	return []string{
+		strconv.FormatInt(o.ID, 10),
+		strconv.FormatInt(o.Version, 10),
+		formatCSVTime(&o.CreatedAt),
+		formatCSVTime(&o.UpdatedAt),
+		formatCSVTime(o.DeletedAt),
+		string(o.Status),
+		o.PaymentMethod,
+		strconv.FormatFloat(o.TaxPrice, 'f', 2, 64),
+		strconv.FormatFloat(o.ShippingPrice, 'f', 2, 64),
+		strconv.FormatFloat(o.TotalPrice, 'f', 2, 64),
+		string(items),
+	}
+}
+
+func (h *productHandler) exportProducts(w http.ResponseWriter, r *http.Request) {
+	format, err := parseExportFormat(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	filter, err := parseProductFilter(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	export := &exportWriter[entity.Product]{
+		w:      w,
+		format: format,
+		name:   "products",
+		header: productCSVHeader,
+		record: productCSVRecord,
+		res:    func(p *entity.Product) interface{} { return toProductRes(p) },
+	}
+	export.finish(r, h.service.ExportProducts(r.Context(), filter, export.write))
+}
+
+func (h *orderHandler) exportOrders(w http.ResponseWriter, r *http.Request) {
+	format, err := parseExportFormat(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	export := &exportWriter[entity.Order]{
+		w:      w,
+		format: format,
+		name:   "orders",
+		header: orderCSVHeader,
+		record: orderCSVRecord,
+		res:    func(o *entity.Order) interface{} { return toOrderRes(o) },
+	}
+	export.finish(r, h.service.ExportOrders(r.Context(), filter, export.write))
+}
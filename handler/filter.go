@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSort reads a comma separated list of fields where a leading "-" sorts
+// that field in descending order, e.g. "price,-created_at".
+func parseSort(v string) ([]entity.SortField, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var sort []entity.SortField
+	for _, field := range strings.Split(v, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		if field == "" {
+			return nil, fmt.Errorf("invalid sort %q", v)
+		}
+		sort = append(sort, entity.SortField{Field: field, Desc: desc})
+	}
+
+	return sort, nil
+}
+
+// parseTime accepts either an RFC 3339 timestamp or a plain date.
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.DateOnly, v)
+}
+
+// parseIncludeDeleted reads the include_deleted query parameter which lets
+// admins see soft deleted rows.
+func parseIncludeDeleted(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("include_deleted")
+	if v == "" {
+		return false, nil
+	}
+
+	includeDeleted, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid include_deleted %q", v)
+	}
+
+	return includeDeleted, nil
+}
+
+func parseOrderFilter(r *http.Request) (entity.OrderFilter, error) {
+	var f entity.OrderFilter
+
+	includeDeleted, err := parseIncludeDeleted(r)
+	if err != nil {
+		return f, err
+	}
+	f.IncludeDeleted = includeDeleted
+
+	return f, nil
+}
+
+// parseReviewFilter reads the status query parameter. Without it only
+// published reviews are listed.
+func parseReviewFilter(r *http.Request) (entity.ReviewFilter, error) {
+	f := entity.ReviewFilter{Status: entity.ReviewStatusPublished}
+
+	if v := r.URL.Query().Get("status"); v != "" {
+		f.Status = entity.ReviewStatus(v)
+		if !f.Status.Valid() {
+			return f, fmt.Errorf("invalid status %q", v)
+		}
+	}
+
+	return f, nil
+}
+
+// parseStockAlertFilter reads the status and product_id query parameters.
+// Without a status open and resolved alerts are listed.
+func parseStockAlertFilter(r *http.Request) (entity.StockAlertFilter, error) {
+	var f entity.StockAlertFilter
+	q := r.URL.Query()
+
+	if v := q.Get("status"); v != "" {
+		f.Status = entity.StockAlertStatus(v)
+		if !f.Status.Valid() {
+			return f, fmt.Errorf("invalid status %q", v)
+		}
+	}
+
+	if v := q.Get("product_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid product_id %q", v)
+		}
+		f.ProductID = &id
+	}
+
+	return f, nil
+}
+
+// parsePriceAt reads the optional at query parameter which narrows the price
+// history down to the price effective at that time.
+func parsePriceAt(r *http.Request) (*time.Time, error) {
+	v := r.URL.Query().Get("at")
+	if v == "" {
+		return nil, nil
+	}
+
+	at, err := parseTime(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid at %q", v)
+	}
+
+	return &at, nil
+}
+
+// parseVariantID reads the optional variant_id query parameter.
+func parseVariantID(r *http.Request) (*int64, error) {
+	v := r.URL.Query().Get("variant_id")
+	if v == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid variant_id %q", v)
+	}
+
+	return &id, nil
+}
+
+// parseStockAt reads the at query parameter, the point in time to report the
+// stock at. It defaults to now.
+func parseStockAt(r *http.Request) (time.Time, error) {
+	v := r.URL.Query().Get("at")
+	if v == "" {
+		return time.Now(), nil
+	}
+
+	at, err := parseTime(v)
+	if err != nil {
+		return at, fmt.Errorf("invalid at %q", v)
+	}
+
+	return at, nil
+}
+
+func parseProductFilter(r *http.Request) (entity.ProductFilter, error) {
+	var f entity.ProductFilter
+	q := r.URL.Query()
+
+	includeDeleted, err := parseIncludeDeleted(r)
+	if err != nil {
+		return f, err
+	}
+	f.IncludeDeleted = includeDeleted
+
+	if v := q.Get("category_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid category_id %q", v)
+		}
+		f.CategoryID = &id
+	}
+
+	f.Category = q.Get("category")
+
+	if v := q.Get("include_descendants"); v != "" {
+		includeDescendants, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid include_descendants %q", v)
+		}
+		f.IncludeDescendants = includeDescendants
+	}
+
+	if v := q.Get("min_price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid min_price %q", v)
+		}
+		f.MinPrice = &price
+	}
+
+	if v := q.Get("max_price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid max_price %q", v)
+		}
+		f.MaxPrice = &price
+	}
+
+	if v := q.Get("min_rating"); v != "" {
+		rating, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid min_rating %q", v)
+		}
+		f.MinRating = &rating
+	}
+
+	if v := q.Get("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid in_stock %q", v)
+		}
+		f.InStock = inStock
+	}
+
+	if v := q.Get("created_after"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid created_after %q", v)
+		}
+		f.CreatedAfter = &t
+	}
+
+	if v := q.Get("created_before"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid created_before %q", v)
+		}
+		f.CreatedBefore = &t
+	}
+
+	sort, err := parseSort(q.Get("sort"))
+	if err != nil {
+		return f, err
+	}
+	f.Sort = sort
+
+	return f, nil
+}
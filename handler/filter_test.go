@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStockAt(t *testing.T) {
+	tcs := []struct {
+		name   string
+		query  string
+		want   time.Time
+		offset int
+		err    string
+	}{
+		{
+			name:  "utc",
+			query: "at=2024-03-01T10:00:00Z",
+			want:  time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "non-utc offset is kept",
+			query:  "at=2024-03-01T10:00:00%2B02:00",
+			want:   time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC),
+			offset: 2 * 60 * 60,
+		},
+		{
+			name:  "date",
+			query: "at=2024-03-01",
+			want:  time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "invalid",
+			query: "at=yesterday",
+			err:   `invalid at "yesterday"`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			at, err := parseStockAt(httptest.NewRequest("GET", "/product/1/stock?"+tc.query, nil))
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.True(t, tc.want.Equal(at), "got %v", at)
+			_, offset := at.Zone()
+			require.Equal(t, tc.offset, offset)
+		})
+	}
+}
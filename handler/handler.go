@@ -1,28 +1,99 @@
 package handler
 
-import (
-	"net/http"
-
-	"github.com/go-chi/chi"
-)
-
-var r *chi.Mux
-
-func ProductHandler(handler *productHandler) {
-	r = chi.NewRouter()
+import "github.com/go-chi/chi"
 
+func ProductHandler(r chi.Router, handler *productHandler) {
 	r.Route("/product", func(r chi.Router) {
 		r.Get("/", handler.listProducts)
 		r.Post("/", handler.createProduct)
+		r.Get("/search", handler.searchProducts)
+		r.Get("/export", handler.exportProducts)
+		r.Post("/bulk", handler.createProducts)
+		r.Patch("/bulk", handler.updateProducts)
+		r.Delete("/bulk", handler.deleteProducts)
+		r.Post("/import", handler.importProducts)
+		r.Get("/import/{importID}", handler.getProductImport)
 
 		r.Route("/{id}", func(r chi.Router) {
 			r.Get("/", handler.getProduct)
 			r.Patch("/", handler.updateProduct)
+			r.Put("/", handler.replaceProduct)
 			r.Delete("/", handler.deleteProduct)
+			r.Post("/restore", handler.restoreProduct)
+
+			r.Route("/variants", func(r chi.Router) {
+				r.Get("/", handler.listVariants)
+				r.Post("/", handler.createVariant)
+				r.Get("/{variantID}", handler.getVariant)
+				r.Put("/{variantID}", handler.replaceVariant)
+				r.Delete("/{variantID}", handler.deleteVariant)
+			})
+		})
+	})
+}
+
+func ReviewHandler(r chi.Router, handler *reviewHandler) {
+	r.Route("/product/{id}/reviews", func(r chi.Router) {
+		r.Get("/", handler.listReviews)
+		r.Post("/", handler.createReview)
+
+		r.Route("/{reviewID}", func(r chi.Router) {
+			r.Get("/", handler.getReview)
+			r.Put("/", handler.updateReview)
+			r.Delete("/", handler.deleteReview)
+			r.Post("/moderation", handler.moderateReview)
+		})
+	})
+}
+
+func PriceHandler(r chi.Router, handler *priceHandler) {
+	r.Route("/product/{id}/prices", func(r chi.Router) {
+		r.Get("/", handler.listPrices)
+		r.Post("/", handler.schedulePrice)
+		r.Delete("/{priceID}", handler.deletePrice)
+	})
+}
+
+func StockHandler(r chi.Router, handler *stockHandler) {
+	r.Route("/product/{id}/stock", func(r chi.Router) {
+		r.Get("/", handler.getStock)
+		r.Post("/", handler.changeStock)
+		r.Get("/movements", handler.listStockMovements)
+	})
+}
+
+func InventoryHandler(r chi.Router, handler *inventoryHandler) {
+	r.Route("/inventory", func(r chi.Router) {
+		r.Get("/alerts", handler.listStockAlerts)
+	})
+}
+
+func CategoryHandler(r chi.Router, handler *categoryHandler) {
+	r.Route("/category", func(r chi.Router) {
+		r.Get("/", handler.listCategories)
+		r.Post("/", handler.createCategory)
+		r.Get("/tree", handler.categoryTree)
+
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", handler.getCategory)
+			r.Put("/", handler.updateCategory)
+			r.Delete("/", handler.deleteCategory)
 		})
 	})
 }
 
-func Start(addr string) error {
-	return http.ListenAndServe(addr, r)
+func OrderHandler(r chi.Router, handler *orderHandler) {
+	r.Route("/order", func(r chi.Router) {
+		r.Get("/", handler.listOrders)
+		r.Post("/", handler.createOrder)
+		r.Get("/export", handler.exportOrders)
+
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", handler.getOrder)
+			r.Delete("/", handler.deleteOrder)
+			r.Get("/transitions", handler.listOrderTransitions)
+			r.Post("/transitions", handler.transitionOrder)
+			r.Post("/cancel", handler.cancelOrder)
+		})
+	})
 }
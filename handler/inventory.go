@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/service"
+	"encoding/json"
+	"net/http"
+)
+
+type inventoryHandler struct {
+	service *service.InventoryService
+}
+
+func NewInventoryController(service *service.InventoryService) *inventoryHandler {
+	return &inventoryHandler{
+		service: service,
+	}
+}
+
+func toStockAlertRes(a *entity.StockAlert) entity.StockAlertRes {
+	status := entity.StockAlertStatusOpen
+	if a.ResolvedAt != nil {
+		status = entity.StockAlertStatusResolved
+	}
+
+	return entity.StockAlertRes{
+		ID:               a.ID,
+		CreatedAt:        a.CreatedAt,
+		ProductID:        a.ProductID,
+		CountInStock:     a.CountInStock,
+		ReorderThreshold: a.ReorderThreshold,
+		Status:           status,
+		NotifiedAt:       a.NotifiedAt,
+		ResolvedAt:       a.ResolvedAt,
+	}
+}
+
+func (h *inventoryHandler) listStockAlerts(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	filter, err := parseStockAlertFilter(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	alerts, err := h.service.ListStockAlerts(r.Context(), filter, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toListRes(alerts, toStockAlertRes)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
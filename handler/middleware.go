@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// MiddlewareConfig selects the middlewares that wrap every route.
+type MiddlewareConfig struct {
+	RealIP    bool
+	RequestID bool
+	AccessLog bool
+	Recover   bool
+	CORS      CORSConfig
+}
+
+// CORSConfig configures cross-origin requests. CORS is disabled while
+// AllowedOrigins is empty, "*" allows any origin.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	MaxAge         time.Duration
+}
+
+// Middlewares returns the enabled middlewares in the order they have to be
+// applied. The real IP is resolved first so that it ends up in the access
+// log, and panics are recovered inside the access log so that their 500 is
+// logged.
+func Middlewares(cfg MiddlewareConfig) []func(http.Handler) http.Handler {
+	var mws []func(http.Handler) http.Handler
+	if cfg.RealIP {
+		mws = append(mws, middleware.RealIP)
+	}
+	if cfg.RequestID {
+		mws = append(mws, requestID)
+	}
+	if cfg.AccessLog {
+		mws = append(mws, accessLog)
+	}
+	if cfg.Recover {
+		mws = append(mws, recoverer)
+	}
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		mws = append(mws, cors(cfg.CORS))
+	}
+
+	return mws
+}
+
+// requestID takes the request ID from the X-Request-Id header or generates
+// one, and echoes it in the response.
+func requestID(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// accessLog logs one structured line per request once it has been served.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		slog.InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"latency", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+			"request_id", middleware.GetReqID(r.Context()))
+	})
+}
+
+// recoverer turns a panic in a handler into a logged internal error. The JSON
+// 500 is only written if the handler has not started its response yet.
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			// the server aborts the response without logging
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			err := fmt.Errorf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rvr, debug.Stack())
+			if ww.Status() != 0 {
+				slog.ErrorContext(r.Context(), "panic after response started", "error", err)
+				return
+			}
+			writeError(ww, r, err)
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// cors answers preflight requests and adds the CORS headers to the responses
+// for allowed origins. Requests from other origins are served without them,
+// so that the browser blocks the response.
+func cors(cfg CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !anyOrigin && !slices.Contains(cfg.AllowedOrigins, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				if headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				if cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
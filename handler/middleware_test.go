@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"bytes"
+	"chi-sqlx/database/entity"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// serveWith serves req with the configured middlewares wrapped around next.
+func serveWith(cfg MiddlewareConfig, next http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	mws := Middlewares(cfg)
+	h := next
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// captureLog sends the default logger to the returned buffer for the rest of
+// the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	return &buf
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestCORS(t *testing.T) {
+	cfg := MiddlewareConfig{CORS: CORSConfig{
+		AllowedOrigins: []string{"https://shop.example"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type"},
+		ExposedHeaders: []string{"ETag"},
+		MaxAge:         10 * time.Minute,
+	}}
+
+	tcs := []struct {
+		name      string
+		method    string
+		origin    string
+		status    int
+		wantAllow bool
+		headers   map[string]string
+	}{
+		{
+			name:      "preflight from allowed origin",
+			method:    http.MethodOptions,
+			origin:    "https://shop.example",
+			status:    http.StatusNoContent,
+			wantAllow: true,
+			headers: map[string]string{
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:   "preflight from blocked origin",
+			method: http.MethodOptions,
+			origin: "https://evil.example",
+			status: http.StatusOK,
+		},
+		{
+			name:      "request from allowed origin",
+			method:    http.MethodGet,
+			origin:    "https://shop.example",
+			status:    http.StatusOK,
+			wantAllow: true,
+			headers:   map[string]string{"Access-Control-Expose-Headers": "ETag"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/products", nil)
+			req.Header.Set("Origin", tc.origin)
+			if tc.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			rec := serveWith(cfg, okHandler, req)
+			require.Equal(t, tc.status, rec.Code)
+			require.Contains(t, rec.Header().Values("Vary"), "Origin")
+			if !tc.wantAllow {
+				require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+				require.Empty(t, rec.Header().Get("Access-Control-Allow-Methods"))
+				return
+			}
+
+			require.Equal(t, tc.origin, rec.Header().Get("Access-Control-Allow-Origin"))
+			for k, v := range tc.headers {
+				require.Equal(t, v, rec.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestRecoverer(t *testing.T) {
+	logs := captureLog(t)
+
+	panics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	rec := serveWith(MiddlewareConfig{RequestID: true, Recover: true}, panics, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var res entity.ErrorRes
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, entity.ErrorBody{Code: "internal_error", Message: "internal server error", RequestID: "req-1"}, res.Error)
+	require.Contains(t, logs.String(), "panic serving GET /products: boom")
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("X-Request-Id")
+	})
+	cfg := MiddlewareConfig{RequestID: true}
+
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	rec := serveWith(cfg, next, req)
+	require.Equal(t, "req-1", rec.Header().Get("X-Request-Id"))
+	require.Equal(t, "req-1", seen)
+
+	rec = serveWith(cfg, next, httptest.NewRequest(http.MethodGet, "/products", nil))
+	require.NotEmpty(t, rec.Header().Get("X-Request-Id"))
+}
+
+func TestAccessLog(t *testing.T) {
+	tcs := []struct {
+		name    string
+		handler http.Handler
+		status  int
+	}{
+		{
+			name:    "explicit status",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }),
+			status:  http.StatusTeapot,
+		},
+		{
+			name:    "implicit status",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hi")) }),
+			status:  http.StatusOK,
+		},
+		{
+			name:    "recovered panic",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }),
+			status:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLog(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+			req.Header.Set("X-Request-Id", "req-1")
+			serveWith(MiddlewareConfig{RequestID: true, AccessLog: true, Recover: true}, tc.handler, req)
+
+			var entry struct {
+				Msg       string `json:"msg"`
+				Method    string `json:"method"`
+				Path      string `json:"path"`
+				Status    int    `json:"status"`
+				RequestID string `json:"request_id"`
+			}
+			lines := bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n"))
+			require.NoError(t, json.Unmarshal(lines[len(lines)-1], &entry))
+			require.Equal(t, "request", entry.Msg)
+			require.Equal(t, http.MethodPost, entry.Method)
+			require.Equal(t, "/orders", entry.Path)
+			require.Equal(t, tc.status, entry.Status)
+			require.Equal(t, "req-1", entry.RequestID)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type orderHandler struct {
+	service *service.OrderService
+}
+
+func NewOrderController(service *service.OrderService) *orderHandler {
+	return &orderHandler{
+		service: service,
+	}
+}
+
+func toStoreOrder(o entity.OrderReq) *entity.Order {
+	items := make([]entity.OrderItem, 0, len(o.Items))
+	for _, oi := range o.Items {
+		items = append(items, entity.OrderItem{
+			Quantity:  oi.Quantity,
+			ProductID: oi.ProductID,
+			VariantID: oi.VariantID,
+		})
+	}
+
+	return &entity.Order{
+		PaymentMethod: o.PaymentMethod,
+		ShippingPrice: o.ShippingPrice,
+		Items:         items,
+	}
+}
+
+func toOrderItemRes(oi entity.OrderItem) entity.OrderItemRes {
+	return entity.OrderItemRes{
+		ID:        oi.ID,
+		CreatedAt: oi.CreatedAt,
+		UpdatedAt: oi.UpdatedAt,
+		DeletedAt: oi.DeletedAt,
+		Name:      oi.Name,
+		Quantity:  oi.Quantity,
+		Image:     oi.Image,
+		Price:     oi.Price,
+		ProductID: oi.ProductID,
+		VariantID: oi.VariantID,
+		OrderID:   oi.OrderID,
+	}
+}
+
+func toOrderRes(o *entity.Order) entity.OrderRes {
+	items := make([]entity.OrderItemRes, 0, len(o.Items))
+	for _, oi := range o.Items {
+		items = append(items, toOrderItemRes(oi))
+	}
+
+	return entity.OrderRes{
+		ID:            o.ID,
+		Version:       o.Version,
+		CreatedAt:     o.CreatedAt,
+		UpdatedAt:     o.UpdatedAt,
+		DeletedAt:     o.DeletedAt,
+		Status:        o.Status,
+		PaymentMethod: o.PaymentMethod,
+		TaxPrice:      o.TaxPrice,
+		ShippingPrice: o.ShippingPrice,
+		TotalPrice:    o.TotalPrice,
+		Items:         items,
+	}
+}
+
+func (h *orderHandler) createOrder(w http.ResponseWriter, r *http.Request) {
+	var o entity.OrderReq
+	if err := decodeAndValidate(w, r, &o); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	order, err := h.service.CreateOrder(r.Context(), toStoreOrder(o))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toOrderRes(order)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(order.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *orderHandler) getOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	includeDeleted, err := parseIncludeDeleted(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	var order *entity.Order
+	if includeDeleted {
+		order, err = h.service.GetOrderWithDeleted(r.Context(), i)
+	} else {
+		order, err = h.service.GetOrder(r.Context(), i)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toOrderRes(order)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(order.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *orderHandler) listOrders(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	orders, err := h.service.ListOrders(r.Context(), filter, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toListRes(orders, toOrderRes)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *orderHandler) deleteOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	if r.Header.Get("If-Match") == "" {
+		err = h.service.DeleteOrder(r.Context(), i)
+	} else {
+		var order *entity.Order
+		order, err = h.service.GetOrder(r.Context(), i)
+		if err == nil {
+			if matched, _ := checkIfMatch(r, order.Version); !matched {
+				writeError(w, r, preconditionFailed("order"))
+				return
+			}
+			err = h.service.DeleteOrderIfVersion(r.Context(), i, order.Version)
+		}
+	}
+
+	if err != nil {
+		writeError(w, r, versionConflict(err, true))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toOrderStatusHistoryRes(h entity.OrderStatusHistory) entity.OrderStatusHistoryRes {
+	return entity.OrderStatusHistoryRes{
+		ID:         h.ID,
+		CreatedAt:  h.CreatedAt,
+		OrderID:    h.OrderID,
+		FromStatus: h.FromStatus,
+		ToStatus:   h.ToStatus,
+		Reason:     h.Reason,
+	}
+}
+
+func (h *orderHandler) transitionOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	var t entity.OrderTransitionReq
+	if err := decodeAndValidate(w, r, &t); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	order, err := h.service.TransitionOrder(r.Context(), i, t.Status, t.Reason)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toOrderRes(order)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(order.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *orderHandler) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	var c entity.OrderCancelReq
+	if err := decodeAndValidate(w, r, &c); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	order, err := h.service.CancelOrder(r.Context(), i, c.Reason)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toOrderRes(order)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(order.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *orderHandler) listOrderTransitions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	history, err := h.service.ListOrderStatusHistory(r.Context(), i)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := make([]entity.OrderStatusHistoryRes, 0, len(history))
+	for _, sh := range history {
+		res = append(res, toOrderStatusHistoryRes(sh))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// parsePagination reads the limit, offset, cursor and total query parameters.
+func parsePagination(r *http.Request) (entity.Pagination, error) {
+	var page entity.Pagination
+	q := r.URL.Query()
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page, errors.New("offset must be a non-negative integer")
+		}
+		page.Offset = offset
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := entity.DecodeCursor(v)
+		if err != nil {
+			return page, err
+		}
+		page.Cursor = cursor
+	}
+
+	if v := q.Get("total"); v != "" {
+		withTotal, err := strconv.ParseBool(v)
+		if err != nil {
+			return page, errors.New("total must be a boolean")
+		}
+		page.WithTotal = withTotal
+	}
+
+	return page, nil
+}
+
+func toListRes[T any, R any](page *entity.Page[T], fn func(*T) R) entity.ListRes[R] {
+	res := entity.ListRes[R]{
+		Data:  make([]R, 0, len(page.Items)),
+		Total: page.Total,
+	}
+
+	for i := range page.Items {
+		res.Data = append(res.Data, fn(&page.Items[i]))
+	}
+
+	if page.NextCursor != nil {
+		next := page.NextCursor.Encode()
+		res.NextCursor = &next
+	}
+
+	return res
+}
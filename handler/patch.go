@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	contentTypeJSON       = "application/json"
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to target. Keys set to null
+// in the patch are removed, objects are merged recursively and every other
+// value replaces the target value.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+
+	return targetObj
+}
+
+// jsonPatchOp is a single RFC 6902 JSON Patch operation.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies the RFC 6902 operations to doc in order. Documents are
+// addressed with JSON Pointers into nested objects; arrays are not supported
+// because none of the patched resources contain them.
+func applyJSONPatch(doc map[string]interface{}, ops []jsonPatchOp) error {
+	for i, op := range ops {
+		if err := applyJSONPatchOp(doc, op); err != nil {
+			return fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return nil
+}
+
+func applyJSONPatchOp(doc map[string]interface{}, op jsonPatchOp) error {
+	switch op.Op {
+	case "add", "replace":
+		value, err := decodePatchValue(op.Value)
+		if err != nil {
+			return err
+		}
+
+		parent, key, err := resolvePointer(doc, op.Path)
+		if err != nil {
+			return err
+		}
+		if _, exists := parent[key]; op.Op == "replace" && !exists {
+			return errors.New("path does not exist")
+		}
+		parent[key] = value
+
+	case "remove":
+		parent, key, err := resolvePointer(doc, op.Path)
+		if err != nil {
+			return err
+		}
+		if _, exists := parent[key]; !exists {
+			return errors.New("path does not exist")
+		}
+		delete(parent, key)
+
+	case "move", "copy":
+		from, fromKey, err := resolvePointer(doc, op.From)
+		if err != nil {
+			return err
+		}
+		value, exists := from[fromKey]
+		if !exists {
+			return errors.New("from path does not exist")
+		}
+		if op.Op == "move" {
+			delete(from, fromKey)
+		}
+
+		parent, key, err := resolvePointer(doc, op.Path)
+		if err != nil {
+			return err
+		}
+		parent[key] = value
+
+	case "test":
+		value, err := decodePatchValue(op.Value)
+		if err != nil {
+			return err
+		}
+
+		parent, key, err := resolvePointer(doc, op.Path)
+		if err != nil {
+			return err
+		}
+		actual, exists := parent[key]
+		if !exists {
+			return errors.New("path does not exist")
+		}
+		if !reflect.DeepEqual(actual, value) {
+			return errors.New("test failed")
+		}
+
+	default:
+		return errors.New("unsupported operation")
+	}
+
+	return nil
+}
+
+func decodePatchValue(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("missing value")
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+
+	return value, nil
+}
+
+// resolvePointer walks an RFC 6901 JSON Pointer and returns the object that
+// holds the last reference token together with that token.
+func resolvePointer(doc map[string]interface{}, pointer string) (map[string]interface{}, string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, "", fmt.Errorf("invalid path %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	parent := doc
+	for _, token := range tokens[:len(tokens)-1] {
+		child, ok := parent[token].(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("path %q does not exist", pointer)
+		}
+		parent = child
+	}
+
+	return parent, tokens[len(tokens)-1], nil
+}
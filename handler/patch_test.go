@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decodeDoc(t *testing.T, s string) map[string]interface{} {
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(s), &doc))
+	return doc
+}
+
+func TestMergePatch(t *testing.T) {
+	tcs := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{
+			name:   "replace value",
+			target: `{"name": "old", "price": 10}`,
+			patch:  `{"name": "new"}`,
+			want:   `{"name": "new", "price": 10}`,
+		},
+		{
+			name:   "null removes key",
+			target: `{"name": "old", "image": "a.png"}`,
+			patch:  `{"image": null}`,
+			want:   `{"name": "old"}`,
+		},
+		{
+			name:   "null on missing key",
+			target: `{"name": "old"}`,
+			patch:  `{"image": null}`,
+			want:   `{"name": "old"}`,
+		},
+		{
+			name:   "zero values are kept",
+			target: `{"name": "old", "price": 10, "description": "text"}`,
+			patch:  `{"price": 0, "description": ""}`,
+			want:   `{"name": "old", "price": 0, "description": ""}`,
+		},
+		{
+			name:   "nested objects are merged",
+			target: `{"options": {"size": "M", "color": "red"}}`,
+			patch:  `{"options": {"color": null, "fit": "slim"}}`,
+			want:   `{"options": {"size": "M", "fit": "slim"}}`,
+		},
+		{
+			name:   "object replaces scalar",
+			target: `{"options": "none"}`,
+			patch:  `{"options": {"size": "M"}}`,
+			want:   `{"options": {"size": "M"}}`,
+		},
+		{
+			name:   "empty patch",
+			target: `{"name": "old"}`,
+			patch:  `{}`,
+			want:   `{"name": "old"}`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var patch interface{}
+			require.NoError(t, json.Unmarshal([]byte(tc.patch), &patch))
+
+			got := mergePatch(decodeDoc(t, tc.target), patch)
+			require.Equal(t, decodeDoc(t, tc.want), got)
+		})
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	const doc = `{"name": "old", "price": 10, "image": null, "options": {"size": "M"}, "a/b": 1, "c~d": 2}`
+
+	tcs := []struct {
+		name string
+		ops  string
+		want string
+		err  string
+	}{
+		{
+			name: "add new key",
+			ops:  `[{"op": "add", "path": "/description", "value": "text"}]`,
+			want: `{"name": "old", "price": 10, "image": null, "options": {"size": "M"}, "a/b": 1, "c~d": 2, "description": "text"}`,
+		},
+		{
+			name: "add existing key replaces it",
+			ops:  `[{"op": "add", "path": "/name", "value": "new"}]`,
+			want: `{"name": "new", "price": 10, "image": null, "options": {"size": "M"}, "a/b": 1, "c~d": 2}`,
+		},
+		{
+			name: "add nested key",
+			ops:  `[{"op": "add", "path": "/options/color", "value": "red"}]`,
+			want: `{"name": "old", "price": 10, "image": null, "options": {"size": "M", "color": "red"}, "a/b": 1, "c~d": 2}`,
+		},
+		{
+			name: "add without value",
+			ops:  `[{"op": "add", "path": "/name"}]`,
+			err:  "operation 0 (add /name): missing value",
+		},
+		{
+			name: "add below missing parent",
+			ops:  `[{"op": "add", "path": "/missing/key", "value": 1}]`,
+			err:  `operation 0 (add /missing/key): path "/missing/key" does not exist`,
+		},
+		{
+			name: "replace",
+			ops:  `[{"op": "replace", "path": "/price", "value": 0}]`,
+			want: `{"name": "old", "price": 0, "image": null, "options": {"size": "M"}, "a/b": 1, "c~d": 2}`,
+		},
+		{
+			name: "replace with null",
+			ops:  `[{"op": "replace", "path": "/name", "value": null}]`,
+			want: `{"name": null, "price": 10, "image": null, "options": {"size": "M"}, "a/b": 1, "c~d": 2}`,
+		},
+		{
+			name: "replace missing key",
+			ops:  `[{"op": "replace", "path": "/description", "value": "text"}]`,
+			err:  "operation 0 (replace /description): path does not exist",
+		},
+		{
+			name: "remove",
+			ops:  `[{"op": "remove", "path": "/options/size"}]`,
+			want: `{"name": "old", "price": 10, "image": null, "options": {}, "a/b": 1, "c~d": 2}`,
+		},
+		{
+			name: "remove missing key",
+			ops:  `[{"op": "remove", "path": "/description"}]`,
+			err:  "operation 0 (remove /description): path does not exist",
+		},
+		{
+			name: "move",
+			ops:  `[{"op": "move", "from": "/name", "path": "/description"}]`,
+			want: `{"price": 10, "image": null, "options": {"size": "M"}, "a/b": 1, "c~d": 2, "description": "old"}`,
+		},
+		{
+			name: "move missing key",
+			ops:  `[{"op": "move", "from": "/description", "path": "/name"}]`,
+			err:  "operation 0 (move /name): from path does not exist",
+		},
+		{
+			name: "copy",
+			ops:  `[{"op": "copy", "from": "/name", "path": "/description"}]`,
+			want: `{"name": "old", "price": 10, "image": null, "options": {"size": "M"}, "a/b": 1, "c~d": 2, "description": "old"}`,
+		},
+		{
+			name: "copy to missing parent",
+			ops:  `[{"op": "copy", "from": "/name", "path": "/missing/name"}]`,
+			err:  `operation 0 (copy /missing/name): path "/missing/name" does not exist`,
+		},
+		{
+			name: "test passes",
+			ops:  `[{"op": "test", "path": "/price", "value": 10}, {"op": "test", "path": "/options", "value": {"size": "M"}}]`,
+			want: doc,
+		},
+		{
+			name: "test null value",
+			ops:  `[{"op": "test", "path": "/image", "value": null}]`,
+			want: doc,
+		},
+		{
+			name: "test fails",
+			ops:  `[{"op": "test", "path": "/price", "value": 11}]`,
+			err:  "operation 0 (test /price): test failed",
+		},
+		{
+			name: "test null against missing key",
+			ops:  `[{"op": "test", "path": "/description", "value": null}]`,
+			err:  "operation 0 (test /description): path does not exist",
+		},
+		{
+			name: "test without value",
+			ops:  `[{"op": "test", "path": "/price"}]`,
+			err:  "operation 0 (test /price): missing value",
+		},
+		{
+			name: "escaped pointer tokens",
+			ops:  `[{"op": "replace", "path": "/a~1b", "value": 3}, {"op": "remove", "path": "/c~0d"}]`,
+			want: `{"name": "old", "price": 10, "image": null, "options": {"size": "M"}, "a/b": 3}`,
+		},
+		{
+			name: "invalid path",
+			ops:  `[{"op": "add", "path": "name", "value": 1}]`,
+			err:  `operation 0 (add name): invalid path "name"`,
+		},
+		{
+			name: "unsupported operation",
+			ops:  `[{"op": "increment", "path": "/price", "value": 1}]`,
+			err:  "operation 0 (increment /price): unsupported operation",
+		},
+		{
+			name: "later operation fails",
+			ops:  `[{"op": "replace", "path": "/name", "value": "new"}, {"op": "test", "path": "/name", "value": "old"}]`,
+			err:  "operation 1 (test /name): test failed",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var ops []jsonPatchOp
+			require.NoError(t, json.Unmarshal([]byte(tc.ops), &ops))
+
+			target := decodeDoc(t, doc)
+			err := applyJSONPatch(target, ops)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, decodeDoc(t, tc.want), target)
+		})
+	}
+}
+
+func TestPatchProductReq(t *testing.T) {
+	tcs := []struct {
+		name        string
+		contentType string
+		body        string
+		want        func(*entity.Product)
+		err         error
+	}{
+		{
+			name:        "null clears field",
+			contentType: contentTypeMergePatch,
+			body:        `{"image": null}`,
+			want:        func(p *entity.Product) { p.Image = "" },
+		},
+		{
+			name:        "explicit zero is applied",
+			contentType: contentTypeMergePatch,
+			body:        `{"price": 0, "description": ""}`,
+			want:        func(p *entity.Product) { p.Price, p.Description = 0, "" },
+		},
+		{
+			name:        "plain JSON is a merge patch",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name": "new"}`,
+			want:        func(p *entity.Product) { p.Name = "new" },
+		},
+		{
+			name:        "JSON Patch",
+			contentType: contentTypeJSONPatch,
+			body:        `[{"op": "test", "path": "/name", "value": "old"}, {"op": "replace", "path": "/price", "value": 5}]`,
+			want:        func(p *entity.Product) { p.Price = 5 },
+		},
+		{
+			name:        "unchanged stock is accepted",
+			contentType: contentTypeMergePatch,
+			body:        `{"name": "new", "count_in_stock": 3}`,
+			want:        func(p *entity.Product) { p.Name = "new" },
+		},
+		{
+			name:        "stale stock is ignored",
+			contentType: contentTypeMergePatch,
+			body:        `{"name": "new", "count_in_stock": 10}`,
+			want:        func(p *entity.Product) { p.Name = "new" },
+		},
+		{
+			name:        "stock replaced by JSON Patch is ignored",
+			contentType: contentTypeJSONPatch,
+			body:        `[{"op": "replace", "path": "/count_in_stock", "value": 0}]`,
+			want:        func(p *entity.Product) {},
+		},
+		{
+			name:        "null on required field",
+			contentType: contentTypeMergePatch,
+			body:        `{"name": null}`,
+			err:         apperror.ErrValidation,
+		},
+		{
+			name:        "unknown key",
+			contentType: contentTypeMergePatch,
+			body:        `{"colour": "red"}`,
+			err:         apperror.ErrValidation,
+		},
+		{
+			name:        "failed JSON Patch",
+			contentType: contentTypeJSONPatch,
+			body:        `[{"op": "test", "path": "/name", "value": "new"}]`,
+			err:         apperror.ErrValidation,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        `name=new`,
+			err:         errUnsupportedPatch,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			product := &entity.Product{ID: 1, Name: "old", Image: "a.png", CategoryID: 2, Description: "text", Price: 10, CountInStock: 3}
+
+			err := patchProductReq(product, tc.contentType, strings.NewReader(tc.body))
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			want := &entity.Product{ID: 1, Name: "old", Image: "a.png", CategoryID: 2, Description: "text", Price: 10, CountInStock: 3}
+			tc.want(want)
+			want.UpdatedAt = product.UpdatedAt
+			require.Equal(t, want, product)
+		})
+	}
+}
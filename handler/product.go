@@ -1,57 +1,61 @@
 package handler
 
 import (
+	"bytes"
+	"chi-sqlx/apperror"
 	"chi-sqlx/database/entity"
 	"chi-sqlx/service"
-	"context"
+	"chi-sqlx/validation"
 	"encoding/json"
-	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 )
 
 type productHandler struct {
-	ctx     context.Context
 	service *service.ProductService
 }
 
 func NewProductController(service *service.ProductService) *productHandler {
 	return &productHandler{
-		ctx:     context.Background(),
 		service: service,
 	}
 }
 
 func toStoreProduct(p entity.ProductReq) *entity.Product {
 	return &entity.Product{
-		Name:         p.Name,
-		Image:        p.Image,
-		Category:     p.Category,
-		Description:  p.Description,
-		Rating:       p.Rating,
-		NumReviews:   p.NumReviews,
-		Price:        p.Price,
-		CountInStock: p.CountInStock,
+		Name:             p.Name,
+		Image:            p.Image,
+		CategoryID:       p.CategoryID,
+		Description:      p.Description,
+		Price:            p.Price,
+		CountInStock:     p.CountInStock,
+		ReorderThreshold: p.ReorderThreshold,
 	}
 }
 
 func toProductRes(p *entity.Product) entity.ProductRes {
 	return entity.ProductRes{
-		ID:           p.ID,
-		CreatedAt:    p.CreatedAt,
-		UpdatedAt:    p.UpdatedAt,
-		DeletedAt:    p.DeletedAt,
-		Name:         p.Name,
-		Image:        p.Image,
-		Category:     p.Category,
-		Description:  p.Description,
-		Rating:       p.Rating,
-		NumReviews:   p.NumReviews,
-		Price:        p.Price,
-		CountInStock: p.CountInStock,
+		ID:               p.ID,
+		Version:          p.Version,
+		CreatedAt:        p.CreatedAt,
+		UpdatedAt:        p.UpdatedAt,
+		DeletedAt:        p.DeletedAt,
+		Name:             p.Name,
+		Image:            p.Image,
+		Category:         p.Category,
+		CategoryID:       p.CategoryID,
+		Description:      p.Description,
+		Rating:           p.Rating,
+		NumReviews:       p.NumReviews,
+		Price:            p.Price,
+		CountInStock:     p.CountInStock,
+		ReorderThreshold: p.ReorderThreshold,
 	}
 }
 
@@ -59,52 +63,117 @@ func toTimePtr(t time.Time) time.Time {
 	return t
 }
 
-func patchProductReq(product *entity.Product, p entity.ProductReq) {
-	if p.Name != "" {
-		product.Name = p.Name
+func toProductReq(p *entity.Product) entity.ProductReq {
+	return entity.ProductReq{
+		Name:             p.Name,
+		Image:            p.Image,
+		CategoryID:       p.CategoryID,
+		Description:      p.Description,
+		Price:            p.Price,
+		CountInStock:     p.CountInStock,
+		ReorderThreshold: p.ReorderThreshold,
 	}
-	if p.Image != "" {
-		product.Image = p.Image
+}
+
+// replaceProductReq overwrites every writable field of the product, zero
+// values included. The stock is left alone, it only changes through the stock
+// ledger.
+func replaceProductReq(product *entity.Product, p entity.ProductReq) {
+	product.Name = p.Name
+	product.Image = p.Image
+	product.CategoryID = p.CategoryID
+	product.Description = p.Description
+	product.Price = p.Price
+	product.ReorderThreshold = p.ReorderThreshold
+	product.UpdatedAt = toTimePtr(time.Now())
+}
+
+var errUnsupportedPatch error = &requestError{
+	status:  http.StatusUnsupportedMediaType,
+	code:    "unsupported_media_type",
+	message: "unsupported patch content type",
+}
+
+// patchProductReq applies a PATCH body to the product. Plain JSON and JSON
+// Merge Patch bodies only touch the keys they contain, so an explicit zero or
+// null clears a field. JSON Patch bodies are applied operation by operation.
+func patchProductReq(product *entity.Product, contentType string, body io.Reader) error {
+	mediaType := contentTypeJSON
+	if contentType != "" {
+		mt, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return errUnsupportedPatch
+		}
+		mediaType = mt
 	}
-	if p.Category != "" {
-		product.Category = p.Category
+
+	current, err := json.Marshal(toProductReq(product))
+	if err != nil {
+		return err
 	}
-	if p.Description != "" {
-		product.Description = p.Description
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
 	}
-	if p.Rating != 0 {
-		product.Rating = p.Rating
+
+	switch mediaType {
+	case contentTypeJSON, contentTypeMergePatch:
+		var patch map[string]interface{}
+		if err := decodeStrict(body, &patch); err != nil {
+			return err
+		}
+		mergePatch(doc, patch)
+
+	case contentTypeJSONPatch:
+		var ops []jsonPatchOp
+		if err := decodeStrict(body, &ops); err != nil {
+			return err
+		}
+		if err := applyJSONPatch(doc, ops); err != nil {
+			return apperror.Validation("invalid_patch", err.Error())
+		}
+
+	default:
+		return errUnsupportedPatch
 	}
-	if p.NumReviews != 0 {
-		product.NumReviews = p.NumReviews
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
 	}
-	if p.Price != 0 {
-		product.Price = p.Price
+
+	// unknown keys would otherwise be silently dropped
+	var p entity.ProductReq
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return apperror.Validation("invalid_patch", err.Error())
 	}
-	if p.CountInStock != 0 {
-		product.CountInStock = p.CountInStock
+	if err := validation.Struct(p); err != nil {
+		return err
 	}
-	product.UpdatedAt = toTimePtr(time.Now())
+	replaceProductReq(product, p)
+
+	return nil
 }
 
 func (h *productHandler) createProduct(w http.ResponseWriter, r *http.Request) {
 	var p entity.ProductReq
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "error decoding request body", http.StatusBadRequest)
+	if err := decodeAndValidate(w, r, &p); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	fmt.Println("test", p, toStoreProduct(p))
-
-	product, err := h.service.CreateProduct(h.ctx, toStoreProduct(p))
+	product, err := h.service.CreateProduct(r.Context(), toStoreProduct(p))
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "error creating product", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	res := toProductRes(product)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(product.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(res)
 }
@@ -113,35 +182,91 @@ func (h *productHandler) getProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	i, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
-		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		writeError(w, r, badRequest("error parsing ID"))
 		return
 	}
 
-	product, err := h.service.GetProduct(h.ctx, i)
+	includeDeleted, err := parseIncludeDeleted(r)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "error getting product", http.StatusInternalServerError)
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	var product *entity.Product
+	if includeDeleted {
+		product, err = h.service.GetProductWithDeleted(r.Context(), i)
+	} else {
+		product, err = h.service.GetProduct(r.Context(), i)
+	}
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	res := toProductRes(product)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(product.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
 }
 
 func (h *productHandler) listProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.service.ListProducts(h.ctx)
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	filter, err := parseProductFilter(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	products, err := h.service.ListProducts(r.Context(), filter, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toListRes(products, toProductRes)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func toProductSearchRes(p *entity.ProductSearchResult) entity.ProductSearchRes {
+	return entity.ProductSearchRes{
+		ProductRes: toProductRes(&p.Product),
+		Rank:       p.Rank,
+		Headline:   p.Headline,
+	}
+}
+
+func (h *productHandler) searchProducts(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, r, badRequest("missing search query"))
+		return
+	}
+
+	page, err := parsePagination(r)
 	if err != nil {
-		http.Error(w, "error listing product", http.StatusInternalServerError)
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+	if page.Cursor != nil {
+		writeError(w, r, badRequest("cursor pagination is not supported for search"))
 		return
 	}
 
-	var res []entity.ProductRes
-	for _, p := range products {
-		res = append(res, toProductRes(&p))
+	products, err := h.service.SearchProducts(r.Context(), q, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
+	res := toListRes(products, toProductSearchRes)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
@@ -151,35 +276,79 @@ func (h *productHandler) updateProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	i, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
-		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	product, err := h.service.GetProduct(r.Context(), i)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	matched, conditional := checkIfMatch(r, product.Version)
+	if conditional && !matched {
+		writeError(w, r, preconditionFailed("product"))
+		return
+	}
+
+	// patch our product request
+	if err := patchProductReq(product, r.Header.Get("Content-Type"), limitBody(w, r)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updated, err := h.service.UpdateProduct(r.Context(), product)
+	if err != nil {
+		writeError(w, r, versionConflict(err, conditional))
+		return
+	}
+
+	res := toProductRes(updated)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(updated.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *productHandler) replaceProduct(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
 		return
 	}
 
 	var p entity.ProductReq
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "error decoding request body", http.StatusBadRequest)
+	if err := decodeAndValidate(w, r, &p); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	product, err := h.service.GetProduct(h.ctx, i)
+	product, err := h.service.GetProduct(r.Context(), i)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "error getting product", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	// patch our product request
-	patchProductReq(product, p)
+	matched, conditional := checkIfMatch(r, product.Version)
+	if conditional && !matched {
+		writeError(w, r, preconditionFailed("product"))
+		return
+	}
 
-	updated, err := h.service.UpdateProduct(h.ctx, product)
+	replaceProductReq(product, p)
+
+	updated, err := h.service.UpdateProduct(r.Context(), product)
 	if err != nil {
-		http.Error(w, "error creating product", http.StatusInternalServerError)
+		writeError(w, r, versionConflict(err, conditional))
 		return
 	}
 
 	res := toProductRes(updated)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("ETag", etag(updated.Version))
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
 }
 
@@ -187,14 +356,49 @@ func (h *productHandler) deleteProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	i, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
-		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		writeError(w, r, badRequest("error parsing ID"))
 		return
 	}
 
-	if err := h.service.DeleteProduct(h.ctx, i); err != nil {
-		http.Error(w, "error getting product", http.StatusInternalServerError)
+	if r.Header.Get("If-Match") == "" {
+		err = h.service.DeleteProduct(r.Context(), i)
+	} else {
+		var product *entity.Product
+		product, err = h.service.GetProduct(r.Context(), i)
+		if err == nil {
+			if matched, _ := checkIfMatch(r, product.Version); !matched {
+				writeError(w, r, preconditionFailed("product"))
+				return
+			}
+			err = h.service.DeleteProductIfVersion(r.Context(), i, product.Version)
+		}
+	}
+
+	if err != nil {
+		writeError(w, r, versionConflict(err, true))
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *productHandler) restoreProduct(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	product, err := h.service.RestoreProduct(r.Context(), i)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toProductRes(product)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(product.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"bytes"
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"chi-sqlx/validation"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxBulkItems bounds the number of items of a single bulk request.
+	maxBulkItems = 5000
+	// maxBulkBodyBytes caps the size of a bulk request body.
+	maxBulkBodyBytes = 32 << 20
+)
+
+// parseAtomic reads the atomic query parameter. Bulk requests are all or
+// nothing unless atomic=false asks for best effort.
+func parseAtomic(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("atomic")
+	if v == "" {
+		return true, nil
+	}
+
+	atomic, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, badRequest(fmt.Sprintf("invalid atomic %q", v))
+	}
+
+	return atomic, nil
+}
+
+// decodeBulk reads a bulk request body, a JSON array of items which are
+// decoded one by one so that every item can fail on its own.
+func decodeBulk(w http.ResponseWriter, r *http.Request) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	if err := decodeStrict(http.MaxBytesReader(w, r.Body, maxBulkBodyBytes), &items); err != nil {
+		return nil, err
+	}
+
+	return items, checkBulkSize(len(items))
+}
+
+func checkBulkSize(n int) error {
+	switch {
+	case n == 0:
+		return apperror.Validation("empty_bulk", "bulk request must contain at least one item")
+	case n > maxBulkItems:
+		return apperror.Validation("bulk_too_large", fmt.Sprintf("bulk request must not contain more than %d items", maxBulkItems))
+	}
+
+	return nil
+}
+
+// parseIDs reads a comma separated list of IDs, dropping duplicates.
+func parseIDs(v string) ([]int64, error) {
+	if v == "" {
+		return nil, badRequest("missing ids")
+	}
+
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, s := range strings.Split(v, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, badRequest(fmt.Sprintf("invalid id %q", s))
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func newBulkRes(n int, atomic bool) *entity.BulkRes {
+	res := &entity.BulkRes{Atomic: atomic, Results: make([]entity.BulkItemRes, n)}
+	for i := range res.Results {
+		res.Results[i].Index = i
+	}
+
+	return res
+}
+
+func failBulkItem(ctx context.Context, res *entity.BulkRes, i int, err error) {
+	_, body := toErrorBody(ctx, err)
+	res.Results[i].Status = entity.BulkStatusFailed
+	res.Results[i].Error = &body
+	res.Failed++
+}
+
+func succeedBulkItem(res *entity.BulkRes, i int, status entity.BulkStatus, p *entity.Product) {
+	res.Results[i].Status = status
+	if p != nil {
+		pr := toProductRes(p)
+		res.Results[i].ID = p.ID
+		res.Results[i].Product = &pr
+	}
+	res.Succeeded++
+}
+
+// writeBulkRes answers with status when every item succeeded, 207 Multi-Status
+// when a best effort request partially failed and 422 when an atomic request
+// was rejected. The items of a rejected request that did not fail themselves
+// are reported as skipped.
+func writeBulkRes(w http.ResponseWriter, res *entity.BulkRes, status int) {
+	if res.Failed > 0 {
+		status = http.StatusMultiStatus
+		if res.Atomic {
+			status = http.StatusUnprocessableEntity
+			res.Succeeded = 0
+			for i := range res.Results {
+				if res.Results[i].Status != entity.BulkStatusFailed {
+					res.Results[i].Status = entity.BulkStatusSkipped
+					res.Results[i].Product = nil
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *productHandler) createProducts(w http.ResponseWriter, r *http.Request) {
+	atomic, err := parseAtomic(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	items, err := decodeBulk(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := newBulkRes(len(items), atomic)
+	products := make([]*entity.Product, 0, len(items))
+	indexes := make([]int, 0, len(items))
+	for i, item := range items {
+		var p entity.ProductReq
+		err := decodeStrict(bytes.NewReader(item), &p)
+		if err == nil {
+			err = validation.Struct(p)
+		}
+		if err != nil {
+			failBulkItem(r.Context(), res, i, err)
+			continue
+		}
+
+		products = append(products, toStoreProduct(p))
+		indexes = append(indexes, i)
+	}
+
+	errs, err := h.service.SetCategories(r.Context(), products)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	valid := make([]*entity.Product, 0, len(products))
+	validIndexes := make([]int, 0, len(products))
+	for j, p := range products {
+		if errs[j] != nil {
+			failBulkItem(r.Context(), res, indexes[j], errs[j])
+			continue
+		}
+		valid = append(valid, p)
+		validIndexes = append(validIndexes, indexes[j])
+	}
+	products, indexes = valid, validIndexes
+
+	if atomic && res.Failed > 0 {
+		writeBulkRes(w, res, http.StatusCreated)
+		return
+	}
+
+	created, err := h.service.CreateProducts(r.Context(), products)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	for j, p := range created {
+		succeedBulkItem(res, indexes[j], entity.BulkStatusCreated, p)
+	}
+
+	writeBulkRes(w, res, http.StatusCreated)
+}
+
+// bulkPatch is one item of a bulk PATCH: the product to change, the version
+// it is expected at and a JSON Merge Patch for the remaining fields.
+type bulkPatch struct {
+	index   int
+	id      int64
+	version *int64
+	patch   []byte
+}
+
+func decodeBulkPatch(i int, item json.RawMessage) (*bulkPatch, error) {
+	var fields map[string]json.RawMessage
+	if err := decodeStrict(bytes.NewReader(item), &fields); err != nil {
+		return nil, err
+	}
+
+	bp := &bulkPatch{index: i}
+	if err := json.Unmarshal(fields["id"], &bp.id); err != nil || bp.id <= 0 {
+		return nil, apperror.Validation("validation_failed", "request body is invalid",
+			apperror.FieldError{Field: "id", Message: "is required"})
+	}
+	if raw, ok := fields["version"]; ok {
+		if err := json.Unmarshal(raw, &bp.version); err != nil {
+			return nil, apperror.Validation("validation_failed", "request body is invalid",
+				apperror.FieldError{Field: "version", Message: "must be an integer"})
+		}
+	}
+	delete(fields, "id")
+	delete(fields, "version")
+
+	patch, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	bp.patch = patch
+
+	return bp, nil
+}
+
+func (h *productHandler) updateProducts(w http.ResponseWriter, r *http.Request) {
+	atomic, err := parseAtomic(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	items, err := decodeBulk(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := newBulkRes(len(items), atomic)
+	patches := make([]*bulkPatch, 0, len(items))
+	seen := make(map[int64]bool, len(items))
+	ids := make([]int64, 0, len(items))
+	for i, item := range items {
+		bp, err := decodeBulkPatch(i, item)
+		if err == nil && seen[bp.id] {
+			err = apperror.Validation("duplicate_id", fmt.Sprintf("product %d is patched more than once", bp.id),
+				apperror.FieldError{Field: "id", Message: "must be unique within the request"})
+		}
+		if err != nil {
+			failBulkItem(r.Context(), res, i, err)
+			continue
+		}
+
+		seen[bp.id] = true
+		ids = append(ids, bp.id)
+		patches = append(patches, bp)
+	}
+
+	current, err := h.service.GetProducts(r.Context(), ids)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	byID := make(map[int64]*entity.Product, len(current))
+	for i := range current {
+		byID[current[i].ID] = &current[i]
+	}
+
+	products := make([]*entity.Product, 0, len(patches))
+	indexes := make(map[int64]int, len(patches))
+	for _, bp := range patches {
+		product, ok := byID[bp.id]
+		if !ok {
+			failBulkItem(r.Context(), res, bp.index, repository.ErrProductNotFound)
+			continue
+		}
+		if bp.version != nil && *bp.version != product.Version {
+			failBulkItem(r.Context(), res, bp.index, &repository.VersionConflictError{
+				Resource: "product", ID: bp.id, Expected: *bp.version, Actual: product.Version,
+			})
+			continue
+		}
+		if err := patchProductReq(product, contentTypeMergePatch, bytes.NewReader(bp.patch)); err != nil {
+			failBulkItem(r.Context(), res, bp.index, err)
+			continue
+		}
+
+		products = append(products, product)
+		indexes[product.ID] = bp.index
+	}
+
+	errs, err := h.service.SetCategories(r.Context(), products)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	valid := make([]*entity.Product, 0, len(products))
+	for j, p := range products {
+		if errs[j] != nil {
+			failBulkItem(r.Context(), res, indexes[p.ID], errs[j])
+			continue
+		}
+		valid = append(valid, p)
+	}
+	products = valid
+
+	if atomic && res.Failed > 0 {
+		writeBulkRes(w, res, http.StatusOK)
+		return
+	}
+
+	missed, err := h.service.UpdateProducts(r.Context(), products, atomic)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	conflicts := make(map[int64]bool, len(missed))
+	for _, id := range missed {
+		conflicts[id] = true
+		failBulkItem(r.Context(), res, indexes[id], apperror.Conflict("version_conflict", fmt.Sprintf("product %d was modified concurrently", id)))
+	}
+	for _, p := range products {
+		if !conflicts[p.ID] {
+			succeedBulkItem(res, indexes[p.ID], entity.BulkStatusUpdated, p)
+		}
+	}
+
+	writeBulkRes(w, res, http.StatusOK)
+}
+
+func (h *productHandler) deleteProducts(w http.ResponseWriter, r *http.Request) {
+	atomic, err := parseAtomic(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ids, err := parseIDs(r.URL.Query().Get("ids"))
+	if err == nil {
+		err = checkBulkSize(len(ids))
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	missed, err := h.service.DeleteProducts(r.Context(), ids, atomic)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	notFound := make(map[int64]bool, len(missed))
+	for _, id := range missed {
+		notFound[id] = true
+	}
+
+	res := newBulkRes(len(ids), atomic)
+	for i, id := range ids {
+		res.Results[i].ID = id
+		if notFound[id] {
+			failBulkItem(r.Context(), res, i, repository.ErrProductNotFound)
+		} else {
+			succeedBulkItem(res, i, entity.BulkStatusDeleted, nil)
+		}
+	}
+
+	writeBulkRes(w, res, http.StatusOK)
+}
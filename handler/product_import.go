@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	// maxImportBytes caps the size of an import upload.
+	maxImportBytes = 1 << 30
+	// importReadTimeout bounds how long an import upload may take, enough for
+	// maxImportBytes at about 1 MiB/s.
+	importReadTimeout = 20 * time.Minute
+)
+
+var errUnsupportedImport error = &requestError{
+	status:  http.StatusUnsupportedMediaType,
+	code:    "unsupported_media_type",
+	message: "import must be text/csv or application/x-ndjson",
+}
+
+// parseImportFormat takes the format from the format query parameter or else
+// from the Content-Type of the upload.
+func parseImportFormat(r *http.Request) (entity.ImportFormat, error) {
+	switch v := r.URL.Query().Get("format"); v {
+	case "":
+	case string(entity.ImportFormatCSV), string(entity.ImportFormatNDJSON):
+		return entity.ImportFormat(v), nil
+	default:
+		return "", badRequest(fmt.Sprintf("invalid format %q", v))
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", errUnsupportedImport
+	}
+
+	switch mediaType {
+	case contentTypeCSV:
+		return entity.ImportFormatCSV, nil
+	case contentTypeNDJSON, "application/ndjson", "application/jsonl":
+		return entity.ImportFormatNDJSON, nil
+	default:
+		return "", errUnsupportedImport
+	}
+}
+
+// spoolFile is an upload spooled to disk, removed when closed.
+type spoolFile struct {
+	*os.File
+}
+
+func (f spoolFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+
+	return err
+}
+
+// spoolBody copies the request body to a temporary file, so that the import
+// can outlive the request.
+func spoolBody(w http.ResponseWriter, r *http.Request) (*spoolFile, error) {
+	f, err := os.CreateTemp("", "product-import-*")
+	if err != nil {
+		return nil, err
+	}
+	spool := &spoolFile{f}
+
+	// large uploads may take longer than the server's read timeout, so they
+	// get a deadline sized for the largest upload instead
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(importReadTimeout))
+
+	if _, err := io.Copy(f, http.MaxBytesReader(w, r.Body, maxImportBytes)); err != nil {
+		spool.Close()
+		return nil, decodeError(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		spool.Close()
+		return nil, err
+	}
+
+	return spool, nil
+}
+
+func (h *productHandler) importProducts(w http.ResponseWriter, r *http.Request) {
+	format, err := parseImportFormat(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, badRequest(fmt.Sprintf("invalid dry_run %q", v)))
+			return
+		}
+	}
+
+	body, err := spoolBody(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	job, err := h.service.StartProductImport(format, body, dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/product/import/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *productHandler) getProductImport(w http.ResponseWriter, r *http.Request) {
+	job, err := h.service.GetProductImport(chi.URLParam(r, "importID"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
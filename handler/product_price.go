@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type priceHandler struct {
+	service *service.PriceService
+}
+
+func NewPriceController(service *service.PriceService) *priceHandler {
+	return &priceHandler{
+		service: service,
+	}
+}
+
+func toProductPriceRes(p *entity.ProductPrice) entity.ProductPriceRes {
+	return entity.ProductPriceRes{
+		ID:            p.ID,
+		CreatedAt:     p.CreatedAt,
+		ProductID:     p.ProductID,
+		Price:         p.Price,
+		EffectiveFrom: p.EffectiveFrom,
+		EffectiveTo:   p.EffectiveTo,
+	}
+}
+
+// parsePriceIDs reads the product and price IDs from the URL.
+func parsePriceIDs(r *http.Request) (productID, id int64, err error) {
+	productID, err = strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, 0, badRequest("error parsing ID")
+	}
+
+	id, err = strconv.ParseInt(chi.URLParam(r, "priceID"), 10, 64)
+	if err != nil {
+		return 0, 0, badRequest("error parsing price ID")
+	}
+
+	return productID, id, nil
+}
+
+func (h *priceHandler) listPrices(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	at, err := parsePriceAt(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	prices, err := h.service.ListPrices(r.Context(), i, at)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := make([]entity.ProductPriceRes, 0, len(prices))
+	for i := range prices {
+		res = append(res, toProductPriceRes(&prices[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *priceHandler) schedulePrice(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	var pr entity.ProductPriceReq
+	if err := decodeAndValidate(w, r, &pr); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	price, err := h.service.SchedulePrice(r.Context(), i, pr.Price, pr.EffectiveFrom)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toProductPriceRes(price)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *priceHandler) deletePrice(w http.ResponseWriter, r *http.Request) {
+	productID, id, err := parsePriceIDs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.service.DeletePrice(r.Context(), productID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+func toStoreVariant(v entity.ProductVariantReq) *entity.ProductVariant {
+	return &entity.ProductVariant{
+		SKU:          v.SKU,
+		Options:      v.Options,
+		Price:        v.Price,
+		CountInStock: v.CountInStock,
+	}
+}
+
+func toProductVariantRes(v *entity.ProductVariant) entity.ProductVariantRes {
+	options := v.Options
+	if options == nil {
+		options = entity.VariantOptions{}
+	}
+
+	return entity.ProductVariantRes{
+		ID:           v.ID,
+		Version:      v.Version,
+		CreatedAt:    v.CreatedAt,
+		UpdatedAt:    v.UpdatedAt,
+		DeletedAt:    v.DeletedAt,
+		ProductID:    v.ProductID,
+		SKU:          v.SKU,
+		Options:      options,
+		Price:        v.Price,
+		CountInStock: v.CountInStock,
+	}
+}
+
+// parseVariantIDs reads the product and variant IDs from the URL.
+func parseVariantIDs(r *http.Request) (productID, id int64, err error) {
+	productID, err = strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, 0, badRequest("error parsing ID")
+	}
+
+	id, err = strconv.ParseInt(chi.URLParam(r, "variantID"), 10, 64)
+	if err != nil {
+		return 0, 0, badRequest("error parsing variant ID")
+	}
+
+	return productID, id, nil
+}
+
+func (h *productHandler) listVariants(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	variants, err := h.service.ListVariants(r.Context(), i)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := make([]entity.ProductVariantRes, 0, len(variants))
+	for i := range variants {
+		res = append(res, toProductVariantRes(&variants[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *productHandler) createVariant(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	var v entity.ProductVariantReq
+	if err := decodeAndValidate(w, r, &v); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	variant := toStoreVariant(v)
+	variant.ProductID = i
+	variant, err = h.service.CreateVariant(r.Context(), variant)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toProductVariantRes(variant)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(variant.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *productHandler) getVariant(w http.ResponseWriter, r *http.Request) {
+	productID, id, err := parseVariantIDs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	variant, err := h.service.GetVariant(r.Context(), productID, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toProductVariantRes(variant)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(variant.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *productHandler) replaceVariant(w http.ResponseWriter, r *http.Request) {
+	productID, id, err := parseVariantIDs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var v entity.ProductVariantReq
+	if err := decodeAndValidate(w, r, &v); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	variant, err := h.service.GetVariant(r.Context(), productID, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	matched, conditional := checkIfMatch(r, variant.Version)
+	if conditional && !matched {
+		writeError(w, r, preconditionFailed("variant"))
+		return
+	}
+
+	variant.SKU = v.SKU
+	variant.Options = v.Options
+	variant.Price = v.Price
+
+	updated, err := h.service.UpdateVariant(r.Context(), variant)
+	if err != nil {
+		writeError(w, r, versionConflict(err, conditional))
+		return
+	}
+
+	res := toProductVariantRes(updated)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(updated.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *productHandler) deleteVariant(w http.ResponseWriter, r *http.Request) {
+	productID, id, err := parseVariantIDs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.service.DeleteVariant(r.Context(), productID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
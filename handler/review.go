@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type reviewHandler struct {
+	service *service.ReviewService
+}
+
+func NewReviewController(service *service.ReviewService) *reviewHandler {
+	return &reviewHandler{
+		service: service,
+	}
+}
+
+func toStoreReview(r entity.ReviewReq) *entity.Review {
+	return &entity.Review{
+		Author: r.Author,
+		Stars:  r.Stars,
+		Title:  r.Title,
+		Body:   r.Body,
+	}
+}
+
+func toReviewRes(r *entity.Review) entity.ReviewRes {
+	return entity.ReviewRes{
+		ID:        r.ID,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+		DeletedAt: r.DeletedAt,
+		ProductID: r.ProductID,
+		Author:    r.Author,
+		Stars:     r.Stars,
+		Title:     r.Title,
+		Body:      r.Body,
+		Status:    r.Status,
+	}
+}
+
+// parseReviewIDs reads the product and review IDs from the URL.
+func parseReviewIDs(r *http.Request) (productID, id int64, err error) {
+	productID, err = strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, 0, badRequest("error parsing ID")
+	}
+
+	id, err = strconv.ParseInt(chi.URLParam(r, "reviewID"), 10, 64)
+	if err != nil {
+		return 0, 0, badRequest("error parsing review ID")
+	}
+
+	return productID, id, nil
+}
+
+func (h *reviewHandler) listReviews(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	filter, err := parseReviewFilter(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	reviews, err := h.service.ListReviews(r.Context(), i, filter, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toListRes(reviews, toReviewRes)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *reviewHandler) createReview(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	var rv entity.ReviewReq
+	if err := decodeAndValidate(w, r, &rv); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	review := toStoreReview(rv)
+	review.ProductID = i
+	review, err = h.service.CreateReview(r.Context(), review)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toReviewRes(review)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *reviewHandler) getReview(w http.ResponseWriter, r *http.Request) {
+	productID, id, err := parseReviewIDs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	review, err := h.service.GetReview(r.Context(), productID, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toReviewRes(review)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *reviewHandler) updateReview(w http.ResponseWriter, r *http.Request) {
+	productID, id, err := parseReviewIDs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var rv entity.ReviewReq
+	if err := decodeAndValidate(w, r, &rv); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	review := toStoreReview(rv)
+	review.ID = id
+	review.ProductID = productID
+	review, err = h.service.UpdateReview(r.Context(), review)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toReviewRes(review)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// moderateReview publishes or rejects a review.
+func (h *reviewHandler) moderateReview(w http.ResponseWriter, r *http.Request) {
+	productID, id, err := parseReviewIDs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var m entity.ReviewModerationReq
+	if err := decodeAndValidate(w, r, &m); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	review, err := h.service.ModerateReview(r.Context(), productID, id, m.Status)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toReviewRes(review)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *reviewHandler) deleteReview(w http.ResponseWriter, r *http.Request) {
+	productID, id, err := parseReviewIDs(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.service.DeleteReview(r.Context(), productID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := NewServer(ServerConfig{ShutdownTimeout: 5 * time.Second}, router)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, ln)
+	}()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		done <- result{status: res.StatusCode, body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	// the server keeps running until the request has finished
+	select {
+	case err := <-served:
+		t.Fatalf("server stopped with a request in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	res := <-done
+	require.NoError(t, res.err)
+	require.Equal(t, http.StatusOK, res.status)
+	require.Equal(t, "done", res.body)
+
+	require.NoError(t, <-served)
+}
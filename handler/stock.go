@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type stockHandler struct {
+	service *service.StockService
+}
+
+func NewStockController(service *service.StockService) *stockHandler {
+	return &stockHandler{
+		service: service,
+	}
+}
+
+func toStockMovementRes(m *entity.StockMovement) entity.StockMovementRes {
+	return entity.StockMovementRes{
+		ID:        m.ID,
+		CreatedAt: m.CreatedAt,
+		ProductID: m.ProductID,
+		VariantID: m.VariantID,
+		Delta:     m.Delta,
+		Reason:    m.Reason,
+		OrderID:   m.OrderID,
+		Actor:     m.Actor,
+	}
+}
+
+func (h *stockHandler) changeStock(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	var sc entity.StockChangeReq
+	if err := decodeAndValidate(w, r, &sc); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	movement := &entity.StockMovement{
+		ProductID: i,
+		VariantID: sc.VariantID,
+		Delta:     sc.Delta,
+		Reason:    sc.Reason,
+		Actor:     sc.Actor,
+	}
+	count, err := h.service.ChangeStock(r.Context(), movement)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := entity.StockChangeRes{
+		Movement:     toStockMovementRes(movement),
+		CountInStock: count,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *stockHandler) getStock(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	variantID, err := parseVariantID(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	at, err := parseStockAt(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	count, err := h.service.StockAt(r.Context(), i, variantID, at)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := entity.StockLevelRes{
+		ProductID:    i,
+		VariantID:    variantID,
+		At:           at,
+		CountInStock: count,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *stockHandler) listStockMovements(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("error parsing ID"))
+		return
+	}
+
+	variantID, err := parseVariantID(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+
+	movements, err := h.service.ListStockMovements(r.Context(), i, variantID, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := toListRes(movements, toStockMovementRes)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"chi-sqlx/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// runImport implements the import subcommand:
+//
+//	chi-sqlx import [-format csv|ndjson] [-dry-run] FILE
+//
+// Progress is logged to stderr, the final report is written to stdout.
+func runImport(db *sqlx.DB, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "csv or ndjson, taken from the file extension when empty")
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing anything")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: import [-format csv|ndjson] [-dry-run] FILE")
+	}
+	path := flags.Arg(0)
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = string(entity.ImportFormatCSV)
+		case ".ndjson", ".jsonl":
+			*format = string(entity.ImportFormatNDJSON)
+		default:
+			return fmt.Errorf("cannot tell the format of %s, use -format", path)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	productService := service.NewProductService(
+		ctx,
+		new(sync.WaitGroup),
+		repository.NewProductRepository(db),
+		repository.NewCategoryRepository(db),
+		repository.NewProductVariantRepository(db),
+		nil,
+	)
+	report, err := productService.ImportProducts(ctx, entity.ImportFormat(*format), f, *dryRun, func(r *entity.ImportReport) {
+		log.Printf("imported %d lines: %d created, %d updated, %d failed", r.Lines, r.Created, r.Updated, r.Failed)
+	})
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	}
+
+	return err
+}
@@ -4,7 +4,12 @@ import (
 	"chi-sqlx/config"
 	"chi-sqlx/database"
 	"chi-sqlx/routes"
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 func main() {
@@ -14,9 +19,47 @@ func main() {
 	if err != nil {
 		log.Fatalf("error opening database: %v", err)
 	}
-	defer db.Close()
 	log.Printf("successfully connected to database %v", dbname)
 
-	// register routes
-	routes.RegisterRoutes(db.GetDB())
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		err := runImport(db.GetDB(), os.Args[2:])
+		db.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := serve(db); err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		log.Fatalf("error closing database: %v", err)
+	}
+	log.Printf("server stopped")
+}
+
+// serve runs the HTTP server until SIGINT or SIGTERM, then drains in-flight
+// requests and waits for the background jobs to stop.
+func serve(db *database.Database) error {
+	var jobs sync.WaitGroup
+	defer jobs.Wait()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	router, err := routes.NewRouter(ctx, db.GetDB(), &jobs)
+	if err != nil {
+		return err
+	}
+	server, err := routes.NewServer(router)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("listening on :%s", config.Env("APP_PORT", "8080"))
+
+	return server.Run(ctx)
 }
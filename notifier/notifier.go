@@ -0,0 +1,112 @@
+// Package notifier delivers low-stock alerts. The log notifier writes them to
+// the application log, the webhook notifier posts them as JSON to a URL and the
+// email notifier stands in for a mail integration by logging the email it
+// would send.
+package notifier
+
+import (
+	"bytes"
+	"chi-sqlx/database/entity"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Notifier tells someone that a product is low on stock. An alert whose
+// notification failed is retried on the next stock check.
+type Notifier interface {
+	NotifyStockAlert(ctx context.Context, a entity.StockAlert) error
+}
+
+// New returns the notifier of the given kind, log, webhook or email. target is
+// the URL of the webhook or the recipient of the emails.
+func New(kind, target string) (Notifier, error) {
+	switch kind {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "webhook":
+		if target == "" {
+			return nil, fmt.Errorf("webhook notifier needs a URL")
+		}
+		return NewWebhookNotifier(target), nil
+	case "email":
+		if target == "" {
+			return nil, fmt.Errorf("email notifier needs a recipient")
+		}
+		return EmailNotifier{To: target}, nil
+	}
+
+	return nil, fmt.Errorf("unknown notifier %q", kind)
+}
+
+func describe(a entity.StockAlert) string {
+	return fmt.Sprintf("product %d is low on stock: %d left, reorder threshold %d", a.ProductID, a.CountInStock, a.ReorderThreshold)
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) NotifyStockAlert(ctx context.Context, a entity.StockAlert) error {
+	slog.InfoContext(ctx, "stock alert",
+		"alert_id", a.ID,
+		"product_id", a.ProductID,
+		"count_in_stock", a.CountInStock,
+		"reorder_threshold", a.ReorderThreshold)
+	return nil
+}
+
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NotifyStockAlert posts the alert as JSON. Any status other than 2xx counts
+// as a failure.
+func (n *WebhookNotifier) NotifyStockAlert(ctx context.Context, a entity.StockAlert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("error encoding stock alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling webhook: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", res.Status)
+	}
+
+	return nil
+}
+
+// EmailNotifier logs the email it would send to To.
+type EmailNotifier struct {
+	To string
+}
+
+func (n EmailNotifier) NotifyStockAlert(ctx context.Context, a entity.StockAlert) error {
+	slog.InfoContext(ctx, "email",
+		"to", n.To,
+		"subject", fmt.Sprintf("Low stock for product %d", a.ProductID),
+		"body", describe(a),
+		"alert_id", a.ID,
+		"product_id", a.ProductID)
+	return nil
+}
@@ -0,0 +1,138 @@
+package notifier
+
+import (
+	"bytes"
+	"chi-sqlx/database/entity"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAlert() entity.StockAlert {
+	return entity.StockAlert{
+		ID:               4,
+		CreatedAt:        time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		ProductID:        7,
+		CountInStock:     2,
+		ReorderThreshold: 5,
+	}
+}
+
+func TestNew(t *testing.T) {
+	tcs := []struct {
+		name   string
+		kind   string
+		target string
+		want   Notifier
+		err    string
+	}{
+		{name: "default", want: LogNotifier{}},
+		{name: "log", kind: "log", want: LogNotifier{}},
+		{name: "email", kind: "email", target: "ops@example.com", want: EmailNotifier{To: "ops@example.com"}},
+		{name: "webhook without URL", kind: "webhook", err: "webhook notifier needs a URL"},
+		{name: "email without recipient", kind: "email", err: "email notifier needs a recipient"},
+		{name: "unknown", kind: "sms", err: `unknown notifier "sms"`},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := New(tc.kind, tc.target)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.want, n)
+		})
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	tcs := []struct {
+		name   string
+		status int
+		err    string
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "no content", status: http.StatusNoContent},
+		{name: "not modified", status: http.StatusNotModified, err: "webhook responded with 304 Not Modified"},
+		{name: "server error", status: http.StatusBadGateway, err: "webhook responded with 502 Bad Gateway"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTestAlert()
+
+			var method, contentType string
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, contentType = r.Method, r.Header.Get("Content-Type")
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			err := NewWebhookNotifier(srv.URL).NotifyStockAlert(context.Background(), a)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			want, err := json.Marshal(a)
+			require.NoError(t, err)
+			require.Equal(t, http.MethodPost, method)
+			require.Equal(t, "application/json", contentType)
+			require.JSONEq(t, string(want), string(body))
+		})
+	}
+}
+
+func TestWebhookNotifierTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n := NewWebhookNotifier(srv.URL)
+	n.client.Timeout = 50 * time.Millisecond
+
+	err := n.NotifyStockAlert(context.Background(), newTestAlert())
+	require.ErrorContains(t, err, "error calling webhook")
+	require.ErrorContains(t, err, "Client.Timeout exceeded")
+}
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+
+	require.NoError(t, LogNotifier{}.NotifyStockAlert(context.Background(), newTestAlert()))
+
+	var entry struct {
+		Level            string `json:"level"`
+		Msg              string `json:"msg"`
+		AlertID          int64  `json:"alert_id"`
+		ProductID        int64  `json:"product_id"`
+		CountInStock     int64  `json:"count_in_stock"`
+		ReorderThreshold int64  `json:"reorder_threshold"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "INFO", entry.Level)
+	require.Equal(t, "stock alert", entry.Msg)
+	require.Equal(t, int64(4), entry.AlertID)
+	require.Equal(t, int64(7), entry.ProductID)
+	require.Equal(t, int64(2), entry.CountInStock)
+	require.Equal(t, int64(5), entry.ReorderThreshold)
+}
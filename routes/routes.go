@@ -4,18 +4,171 @@ import (
 	"chi-sqlx/config"
 	"chi-sqlx/database/repository"
 	"chi-sqlx/handler"
+	"chi-sqlx/notifier"
 	"chi-sqlx/service"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/jmoiron/sqlx"
 )
 
-func RegisterRoutes(db *sqlx.DB) {
-	port := config.Env("APP_PORT", "8080")
+// NewRouter wires the repositories, services and handlers onto a new router.
+// It also starts the background jobs, which run until ctx is done and are
+// tracked by jobs.
+func NewRouter(ctx context.Context, db *sqlx.DB, jobs *sync.WaitGroup) (chi.Router, error) {
+	stockNotifier, err := notifier.New(config.Env("STOCK_ALERT_NOTIFIER", "log"), config.Env("STOCK_ALERT_TARGET", ""))
+	if err != nil {
+		return nil, fmt.Errorf("error configuring stock alerts: %w", err)
+	}
+	checkInterval, err := envDuration("STOCK_CHECK_INTERVAL", "1m")
+	if err != nil {
+		return nil, err
+	}
+	priceInterval, err := envDuration("PRICE_SCHEDULER_INTERVAL", "1m")
+	if err != nil {
+		return nil, err
+	}
+	middlewares, err := middlewareConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	stockAlertRepo := repository.NewStockAlertRepository(db)
+	inventoryService := service.NewInventoryService(stockAlertRepo, stockNotifier)
+	inventoryHandler := handler.NewInventoryController(inventoryService)
+	stockChecker := service.NewStockChecker(inventoryService, checkInterval)
+
+	categoryRepo := repository.NewCategoryRepository(db)
+	categoryService := service.NewCategoryService(categoryRepo)
+	categoryHandler := handler.NewCategoryController(categoryService)
 
 	productRepo := repository.NewProductRepository(db)
-	productService := service.NewProductService(productRepo)
+	variantRepo := repository.NewProductVariantRepository(db)
+	productService := service.NewProductService(ctx, jobs, productRepo, categoryRepo, variantRepo, stockChecker)
 	productHandler := handler.NewProductController(productService)
 
-	handler.ProductHandler(productHandler)
-	handler.Start(":" + port)
+	priceRepo := repository.NewProductPriceRepository(db)
+	priceService := service.NewPriceService(priceRepo, productRepo)
+	priceHandler := handler.NewPriceController(priceService)
+
+	reviewRepo := repository.NewReviewRepository(db)
+	reviewService := service.NewReviewService(reviewRepo, productRepo)
+	reviewHandler := handler.NewReviewController(reviewService)
+
+	stockRepo := repository.NewStockRepository(db)
+	stockService := service.NewStockService(stockRepo, productRepo, variantRepo, stockChecker)
+	stockHandler := handler.NewStockController(stockService)
+
+	orderRepo := repository.NewOrderRepository(db)
+	orderService := service.NewOrderService(orderRepo, stockChecker)
+	orderHandler := handler.NewOrderController(orderService)
+
+	jobs.Add(2)
+	go func() {
+		defer jobs.Done()
+		stockChecker.Run(ctx)
+	}()
+	go func() {
+		defer jobs.Done()
+		priceService.RunScheduler(ctx, priceInterval)
+	}()
+
+	r := chi.NewRouter()
+	r.Use(handler.Middlewares(middlewares)...)
+	handler.CategoryHandler(r, categoryHandler)
+	handler.ProductHandler(r, productHandler)
+	handler.ReviewHandler(r, reviewHandler)
+	handler.PriceHandler(r, priceHandler)
+	handler.StockHandler(r, stockHandler)
+	handler.InventoryHandler(r, inventoryHandler)
+	handler.OrderHandler(r, orderHandler)
+
+	return r, nil
+}
+
+// NewServer serves router on APP_PORT with the timeouts from the environment.
+func NewServer(router http.Handler) (*handler.Server, error) {
+	cfg := handler.ServerConfig{Addr: ":" + config.Env("APP_PORT", "8080")}
+
+	timeouts := []struct {
+		key, fallback string
+		d             *time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", "15s", &cfg.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", "30s", &cfg.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", "60s", &cfg.IdleTimeout},
+		{"HTTP_SHUTDOWN_TIMEOUT", "30s", &cfg.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		d, err := envDuration(t.key, t.fallback)
+		if err != nil {
+			return nil, err
+		}
+		*t.d = d
+	}
+
+	return handler.NewServer(cfg, router), nil
+}
+
+// middlewareConfig reads the middlewares to enable from the environment.
+func middlewareConfig() (handler.MiddlewareConfig, error) {
+	var cfg handler.MiddlewareConfig
+
+	flags := []struct {
+		key, fallback string
+		b             *bool
+	}{
+		{"HTTP_REAL_IP", "false", &cfg.RealIP},
+		{"HTTP_REQUEST_ID", "true", &cfg.RequestID},
+		{"HTTP_ACCESS_LOG", "true", &cfg.AccessLog},
+		{"HTTP_RECOVER", "true", &cfg.Recover},
+	}
+	for _, f := range flags {
+		b, err := strconv.ParseBool(config.Env(f.key, f.fallback))
+		if err != nil {
+			return cfg, fmt.Errorf("error parsing %s: %w", f.key, err)
+		}
+		*f.b = b
+	}
+
+	maxAge, err := envDuration("CORS_MAX_AGE", "10m")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.CORS = handler.CORSConfig{
+		AllowedOrigins: envList("CORS_ALLOWED_ORIGINS", ""),
+		AllowedMethods: envList("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE"),
+		AllowedHeaders: envList("CORS_ALLOWED_HEADERS", "Content-Type,If-Match,X-Request-Id"),
+		ExposedHeaders: envList("CORS_EXPOSED_HEADERS", "ETag,Location,X-Request-Id"),
+		MaxAge:         maxAge,
+	}
+
+	return cfg, nil
+}
+
+// envList splits a comma separated variable, dropping empty entries.
+func envList(key, fallback string) []string {
+	var list []string
+	for _, v := range strings.Split(config.Env(key, fallback), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+func envDuration(key, fallback string) (time.Duration, error) {
+	d, err := time.ParseDuration(config.Env(key, fallback))
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %w", key, err)
+	}
+
+	return d, nil
 }
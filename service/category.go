@@ -0,0 +1,81 @@
+package service
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"context"
+	"strings"
+)
+
+type CategoryService struct {
+	repo *repository.CategoryRepository
+}
+
+func NewCategoryService(repo *repository.CategoryRepository) *CategoryService {
+	return &CategoryService{
+		repo: repo,
+	}
+}
+
+// slugify derives a slug from a name: lowercase letters and digits, every
+// other run of characters becomes a single hyphen.
+func slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+
+	return b.String()
+}
+
+func setSlug(c *entity.Category) error {
+	if c.Slug != "" {
+		return nil
+	}
+
+	c.Slug = slugify(c.Name)
+	if c.Slug == "" {
+		return apperror.Validation("invalid_slug", "cannot derive a slug from the name",
+			apperror.FieldError{Field: "slug", Message: "is required"})
+	}
+
+	return nil
+}
+
+func (s *CategoryService) CreateCategory(ctx context.Context, c *entity.Category) (*entity.Category, error) {
+	if err := setSlug(c); err != nil {
+		return nil, err
+	}
+
+	return s.repo.CreateCategory(ctx, c)
+}
+
+func (s *CategoryService) GetCategory(ctx context.Context, id int64) (*entity.Category, error) {
+	return s.repo.GetCategory(ctx, id)
+}
+
+func (s *CategoryService) ListCategories(ctx context.Context) ([]entity.Category, error) {
+	return s.repo.ListCategories(ctx)
+}
+
+func (s *CategoryService) UpdateCategory(ctx context.Context, c *entity.Category) (*entity.Category, error) {
+	if err := setSlug(c); err != nil {
+		return nil, err
+	}
+
+	return s.repo.UpdateCategory(ctx, c)
+}
+
+func (s *CategoryService) DeleteCategory(ctx context.Context, id int64) error {
+	return s.repo.DeleteCategory(ctx, id)
+}
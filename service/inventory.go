@@ -0,0 +1,107 @@
+package service
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"chi-sqlx/notifier"
+	"context"
+	"log/slog"
+	"time"
+)
+
+type InventoryService struct {
+	alerts   *repository.StockAlertRepository
+	notifier notifier.Notifier
+}
+
+func NewInventoryService(alerts *repository.StockAlertRepository, notifier notifier.Notifier) *InventoryService {
+	return &InventoryService{
+		alerts:   alerts,
+		notifier: notifier,
+	}
+}
+
+// CheckStock resolves the alerts of restocked products, raises alerts for
+// products below their reorder threshold and sends out the notifications of
+// all alerts that are still pending. A failed notification is logged and
+// retried on the next check.
+func (s *InventoryService) CheckStock(ctx context.Context) error {
+	if _, err := s.alerts.ResolveStockAlerts(ctx); err != nil {
+		return err
+	}
+
+	if _, err := s.alerts.OpenStockAlerts(ctx); err != nil {
+		return err
+	}
+
+	pending, err := s.alerts.PendingStockAlerts(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range pending {
+		if err := s.notifier.NotifyStockAlert(ctx, a); err != nil {
+			slog.ErrorContext(ctx, "error notifying stock alert", "alert_id", a.ID, "product_id", a.ProductID, "error", err)
+			continue
+		}
+
+		if err := s.alerts.MarkStockAlertNotified(ctx, a.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *InventoryService) ListStockAlerts(ctx context.Context, filter entity.StockAlertFilter, page entity.Pagination) (*entity.Page[entity.StockAlert], error) {
+	return s.alerts.ListStockAlerts(ctx, filter, page)
+}
+
+// StockChecker runs CheckStock in the background, every interval and soon
+// after it is triggered by a stock change.
+type StockChecker struct {
+	inventory *InventoryService
+	interval  time.Duration
+	trigger   chan struct{}
+}
+
+func NewStockChecker(inventory *InventoryService, interval time.Duration) *StockChecker {
+	return &StockChecker{
+		inventory: inventory,
+		interval:  interval,
+		trigger:   make(chan struct{}, 1),
+	}
+}
+
+// Trigger asks for a check without waiting for it. Triggers that arrive while
+// a check is already pending are merged into it. A nil checker ignores them,
+// e.g. in the import command, which runs without one.
+func (c *StockChecker) Trigger() {
+	if c == nil {
+		return
+	}
+
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks the stock until ctx is done.
+func (c *StockChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.trigger:
+		}
+
+		if err := c.inventory.CheckStock(ctx); err != nil {
+			slog.ErrorContext(ctx, "error checking stock", "error", err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"context"
+	"fmt"
+)
+
+type OrderService struct {
+	repo    *repository.OrderRepository
+	checker *StockChecker
+}
+
+func NewOrderService(repo *repository.OrderRepository, checker *StockChecker) *OrderService {
+	return &OrderService{
+		repo:    repo,
+		checker: checker,
+	}
+}
+
+func (s *OrderService) CreateOrder(ctx context.Context, o *entity.Order) (*entity.Order, error) {
+	o, err := s.repo.CreateOrder(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	s.checker.Trigger()
+	return o, nil
+}
+
+func (s *OrderService) GetOrder(ctx context.Context, id int64) (*entity.Order, error) {
+	return s.repo.GetOrderWithItems(ctx, id)
+}
+
+func (s *OrderService) GetOrderWithDeleted(ctx context.Context, id int64) (*entity.Order, error) {
+	return s.repo.GetOrderWithDeleted(ctx, id)
+}
+
+func (s *OrderService) ListOrders(ctx context.Context, filter entity.OrderFilter, page entity.Pagination) (*entity.Page[entity.Order], error) {
+	return s.repo.ListOrders(ctx, filter, page)
+}
+
+func (s *OrderService) ExportOrders(ctx context.Context, filter entity.OrderFilter, fn func(*entity.Order) error) error {
+	return s.repo.ExportOrders(ctx, filter, fn)
+}
+
+func (s *OrderService) DeleteOrder(ctx context.Context, id int64) error {
+	return s.repo.DeleteOrder(ctx, id)
+}
+
+func (s *OrderService) DeleteOrderIfVersion(ctx context.Context, id, version int64) error {
+	return s.repo.DeleteOrderIfVersion(ctx, id, version)
+}
+
+// orderTransitions lists, for every status, the statuses an order may move to
+// next. Delivered and cancelled orders are final.
+var orderTransitions = map[entity.OrderStatus][]entity.OrderStatus{
+	entity.OrderStatusPending: {entity.OrderStatusPaid, entity.OrderStatusCancelled},
+	entity.OrderStatusPaid:    {entity.OrderStatusShipped, entity.OrderStatusCancelled},
+	entity.OrderStatusShipped: {entity.OrderStatusDelivered},
+}
+
+// InvalidTransitionError is returned when an order cannot move between two statuses.
+type InvalidTransitionError struct {
+	From entity.OrderStatus
+	To   entity.OrderStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("order cannot transition from %q to %q", e.From, e.To)
+}
+
+func (e *InvalidTransitionError) Unwrap() error {
+	return apperror.Conflict("invalid_transition", e.Error())
+}
+
+func CanTransition(from, to entity.OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *OrderService) TransitionOrder(ctx context.Context, id int64, to entity.OrderStatus, reason string) (*entity.Order, error) {
+	if !to.Valid() {
+		return nil, apperror.Validation("invalid_status", fmt.Sprintf("unknown order status %q", to),
+			apperror.FieldError{Field: "status", Message: "unknown order status"})
+	}
+
+	o, err := s.repo.GetOrderWithItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanTransition(o.Status, to) {
+		return nil, &InvalidTransitionError{From: o.Status, To: to}
+	}
+
+	var h *entity.OrderStatusHistory
+	if to == entity.OrderStatusCancelled {
+		// cancelling has to give the reserved stock back
+		h, err = s.repo.CancelOrder(ctx, id, o.Status, reason)
+	} else {
+		h, err = s.repo.UpdateOrderStatus(ctx, id, o.Status, to, reason)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	o.Status = to
+	o.Version++
+	o.UpdatedAt = h.CreatedAt
+
+	return o, nil
+}
+
+func (s *OrderService) CancelOrder(ctx context.Context, id int64, reason string) (*entity.Order, error) {
+	return s.TransitionOrder(ctx, id, entity.OrderStatusCancelled, reason)
+}
+
+func (s *OrderService) ListOrderStatusHistory(ctx context.Context, id int64) ([]entity.OrderStatusHistory, error) {
+	return s.repo.ListOrderStatusHistory(ctx, id)
+}
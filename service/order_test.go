@@ -0,0 +1,47 @@
+package service
+
+import (
+	"chi-sqlx/database/entity"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	const (
+		pending   = entity.OrderStatusPending
+		paid      = entity.OrderStatusPaid
+		shipped   = entity.OrderStatusShipped
+		delivered = entity.OrderStatusDelivered
+		cancelled = entity.OrderStatusCancelled
+	)
+
+	tcs := []struct {
+		name    string
+		from    entity.OrderStatus
+		to      entity.OrderStatus
+		allowed bool
+	}{
+		{name: "pay pending order", from: pending, to: paid, allowed: true},
+		{name: "cancel pending order", from: pending, to: cancelled, allowed: true},
+		{name: "ship paid order", from: paid, to: shipped, allowed: true},
+		{name: "cancel paid order", from: paid, to: cancelled, allowed: true},
+		{name: "deliver shipped order", from: shipped, to: delivered, allowed: true},
+		{name: "ship pending order", from: pending, to: shipped},
+		{name: "deliver pending order", from: pending, to: delivered},
+		{name: "stay pending", from: pending, to: pending},
+		{name: "pay paid order again", from: paid, to: paid},
+		{name: "move paid order back", from: paid, to: pending},
+		{name: "cancel shipped order", from: shipped, to: cancelled},
+		{name: "move shipped order back", from: shipped, to: paid},
+		{name: "leave delivered", from: delivered, to: cancelled},
+		{name: "reopen cancelled order", from: cancelled, to: pending},
+		{name: "unknown status", from: pending, to: "refunded"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.allowed, CanTransition(tc.from, tc.to))
+		})
+	}
+}
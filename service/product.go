@@ -1,37 +1,183 @@
 package service
 
 import (
+	"chi-sqlx/apperror"
 	"chi-sqlx/database/entity"
 	"chi-sqlx/database/repository"
 	"context"
+	"fmt"
+	"sync"
 )
 
 type ProductService struct {
-	repo *repository.ProductRepository
+	repo       *repository.ProductRepository
+	categories *repository.CategoryRepository
+	variants   *repository.ProductVariantRepository
+	imports    *importTracker
+	checker    *StockChecker
 }
 
-func NewProductService(repo *repository.ProductRepository) *ProductService {
+// NewProductService returns a product service whose background imports run
+// until ctx is done and are tracked by jobs.
+func NewProductService(ctx context.Context, jobs *sync.WaitGroup, repo *repository.ProductRepository, categories *repository.CategoryRepository, variants *repository.ProductVariantRepository, checker *StockChecker) *ProductService {
 	return &ProductService{
-		repo: repo,
+		repo:       repo,
+		categories: categories,
+		variants:   variants,
+		imports:    newImportTracker(ctx, jobs),
+		checker:    checker,
 	}
 }
 
+// categoryNames looks up the names of the categories with the given IDs.
+// Unknown IDs are missing from the result.
+func (s *ProductService) categoryNames(ctx context.Context, ids []int64) (map[int64]string, error) {
+	categories, err := s.categories.GetCategories(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int64]string, len(categories))
+	for _, c := range categories {
+		names[c.ID] = c.Name
+	}
+
+	return names, nil
+}
+
+func unknownCategory(id int64) error {
+	return apperror.Validation("unknown_category", fmt.Sprintf("category %d not found", id),
+		apperror.FieldError{Field: "category_id", Message: "does not exist"})
+}
+
+// SetCategories copies the name of their category into the products. The
+// returned errors line up with ps, a product whose category does not exist
+// gets an error of its own so that bulk writes can report it per item.
+func (s *ProductService) SetCategories(ctx context.Context, ps []*entity.Product) ([]error, error) {
+	errs := make([]error, len(ps))
+	if len(ps) == 0 {
+		return errs, nil
+	}
+
+	ids := make([]int64, 0, len(ps))
+	for _, p := range ps {
+		ids = append(ids, p.CategoryID)
+	}
+
+	names, err := s.categoryNames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range ps {
+		name, ok := names[p.CategoryID]
+		if !ok {
+			errs[i] = unknownCategory(p.CategoryID)
+			continue
+		}
+		p.Category = name
+	}
+
+	return errs, nil
+}
+
+func (s *ProductService) setCategory(ctx context.Context, p *entity.Product) error {
+	errs, err := s.SetCategories(ctx, []*entity.Product{p})
+	if err != nil {
+		return err
+	}
+
+	return errs[0]
+}
+
 func (s *ProductService) CreateProduct(ctx context.Context, p *entity.Product) (*entity.Product, error) {
-	return s.repo.CreateProduct(ctx, p)
+	if err := s.setCategory(ctx, p); err != nil {
+		return nil, err
+	}
+
+	p, err := s.repo.CreateProduct(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.checker.Trigger()
+	return p, nil
 }
 
 func (s *ProductService) GetProduct(ctx context.Context, id int64) (*entity.Product, error) {
 	return s.repo.GetProduct(ctx, id)
 }
 
-func (s *ProductService) ListProducts(ctx context.Context) ([]entity.Product, error) {
-	return s.repo.ListProducts(ctx)
+func (s *ProductService) GetProductWithDeleted(ctx context.Context, id int64) (*entity.Product, error) {
+	return s.repo.GetProductWithDeleted(ctx, id)
+}
+
+func (s *ProductService) ListProducts(ctx context.Context, filter entity.ProductFilter, page entity.Pagination) (*entity.Page[entity.Product], error) {
+	return s.repo.ListProducts(ctx, filter, page)
+}
+
+func (s *ProductService) ExportProducts(ctx context.Context, filter entity.ProductFilter, fn func(*entity.Product) error) error {
+	return s.repo.ExportProducts(ctx, filter, fn)
+}
+
+func (s *ProductService) SearchProducts(ctx context.Context, q string, page entity.Pagination) (*entity.Page[entity.ProductSearchResult], error) {
+	return s.repo.SearchProducts(ctx, q, page)
 }
 
 func (s *ProductService) UpdateProduct(ctx context.Context, p *entity.Product) (*entity.Product, error) {
-	return s.repo.UpdateProduct(ctx, p)
+	if err := s.setCategory(ctx, p); err != nil {
+		return nil, err
+	}
+
+	p, err := s.repo.UpdateProduct(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.checker.Trigger()
+	return p, nil
 }
 
 func (s *ProductService) DeleteProduct(ctx context.Context, id int64) error {
 	return s.repo.DeleteProduct(ctx, id)
 }
+
+func (s *ProductService) DeleteProductIfVersion(ctx context.Context, id, version int64) error {
+	return s.repo.DeleteProductIfVersion(ctx, id, version)
+}
+
+func (s *ProductService) RestoreProduct(ctx context.Context, id int64) (*entity.Product, error) {
+	return s.repo.RestoreProduct(ctx, id)
+}
+
+func (s *ProductService) GetProducts(ctx context.Context, ids []int64) ([]entity.Product, error) {
+	return s.repo.GetProducts(ctx, ids)
+}
+
+// CreateProducts creates the products, their categories have to be set with
+// SetCategories first.
+func (s *ProductService) CreateProducts(ctx context.Context, ps []*entity.Product) ([]*entity.Product, error) {
+	ps, err := s.repo.CreateProducts(ctx, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	s.checker.Trigger()
+	return ps, nil
+}
+
+// UpdateProducts updates the products, their categories have to be set with
+// SetCategories first.
+func (s *ProductService) UpdateProducts(ctx context.Context, ps []*entity.Product, atomic bool) ([]int64, error) {
+	missed, err := s.repo.UpdateProducts(ctx, ps, atomic)
+	if err != nil {
+		return nil, err
+	}
+
+	s.checker.Trigger()
+	return missed, nil
+}
+
+func (s *ProductService) DeleteProducts(ctx context.Context, ids []int64, atomic bool) ([]int64, error) {
+	return s.repo.DeleteProducts(ctx, ids, atomic)
+}
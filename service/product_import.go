@@ -0,0 +1,598 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"chi-sqlx/validation"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// importBatchSize is the number of lines looked up and written together.
+	importBatchSize = 500
+	// maxImportResults bounds the per line results kept in a report.
+	maxImportResults = 10000
+	// maxImportLineBytes bounds the length of a single NDJSON line.
+	maxImportLineBytes = 1 << 20
+	// importJobTTL is how long finished imports stay queryable.
+	importJobTTL = time.Hour
+)
+
+// importColumns maps the importable columns, the db tags of entity.Product, onto
+// the kind of value they hold. Generated columns, the category name, which is
+// copied from the category, and the review aggregates cannot be imported.
+var importColumns = func() map[string]reflect.Kind {
+	generated := map[string]bool{
+		"id": true, "version": true, "created_at": true, "updated_at": true, "deleted_at": true,
+		"category": true, "rating": true, "num_reviews": true,
+	}
+
+	columns := make(map[string]reflect.Kind)
+	t := reflect.TypeOf(entity.Product{})
+	for i := 0; i < t.NumField(); i++ {
+		column := t.Field(i).Tag.Get("db")
+		if column != "" && !generated[column] {
+			columns[column] = t.Field(i).Type.Kind()
+		}
+	}
+
+	return columns
+}()
+
+// importRow is one line of an import. fields holds only the columns the line
+// provides, err is set when the line could not be parsed.
+type importRow struct {
+	line   int
+	fields map[string]interface{}
+	err    error
+}
+
+type rowReader interface {
+	// Next returns the next row or io.EOF at the end of the input.
+	Next() (*importRow, error)
+}
+
+func newRowReader(format entity.ImportFormat, r io.Reader) (rowReader, error) {
+	switch format {
+	case entity.ImportFormatCSV:
+		return newCSVRowReader(r)
+	case entity.ImportFormatNDJSON:
+		return newNDJSONRowReader(r), nil
+	default:
+		return nil, apperror.Validation("invalid_format", fmt.Sprintf("unsupported import format %q", format))
+	}
+}
+
+type csvRowReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+// newCSVRowReader reads the header, which must only name importable columns
+// and include name. Empty cells leave the column untouched.
+func newCSVRowReader(r io.Reader) (*csvRowReader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, apperror.Validation("invalid_header", "import is empty")
+	}
+	if err != nil {
+		return nil, apperror.Validation("invalid_header", fmt.Sprintf("invalid CSV header: %v", err))
+	}
+
+	columns := make([]string, len(header))
+	var fields []apperror.FieldError
+	seen := make(map[string]bool)
+	for i, h := range header {
+		column := strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		if _, ok := importColumns[column]; !ok {
+			fields = append(fields, apperror.FieldError{Field: column, Message: "unknown column"})
+		} else if seen[column] {
+			fields = append(fields, apperror.FieldError{Field: column, Message: "duplicate column"})
+		}
+		seen[column] = true
+		columns[i] = column
+	}
+	if !seen["name"] {
+		fields = append(fields, apperror.FieldError{Field: "name", Message: "is required"})
+	}
+	if len(fields) > 0 {
+		return nil, apperror.Validation("invalid_header", "invalid CSV header", fields...)
+	}
+
+	return &csvRowReader{r: cr, header: columns}, nil
+}
+
+func (c *csvRowReader) Next() (*importRow, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return &importRow{line: parseErr.Line, err: apperror.Validation("invalid_line", parseErr.Err.Error())}, nil
+		}
+		return nil, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	row := &importRow{line: line, fields: make(map[string]interface{}, len(record))}
+
+	var fields []apperror.FieldError
+	for i, value := range record {
+		if value == "" {
+			continue
+		}
+
+		column := c.header[i]
+		switch importColumns[column] {
+		case reflect.Int64:
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				fields = append(fields, apperror.FieldError{Field: column, Message: "must be an integer"})
+				continue
+			}
+			row.fields[column] = n
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				fields = append(fields, apperror.FieldError{Field: column, Message: "must be a number"})
+				continue
+			}
+			row.fields[column] = f
+		default:
+			row.fields[column] = value
+		}
+	}
+	if len(fields) > 0 {
+		row.err = apperror.Validation("invalid_line", "line is invalid", fields...)
+	}
+
+	return row, nil
+}
+
+type ndjsonRowReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONRowReader(r io.Reader) *ndjsonRowReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+
+	return &ndjsonRowReader{s: s}
+}
+
+// Next skips blank lines. Unknown keys are reported when the row is applied.
+func (n *ndjsonRowReader) Next() (*importRow, error) {
+	for n.s.Scan() {
+		n.line++
+		b := bytes.TrimSpace(n.s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		row := &importRow{line: n.line}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&row.fields); err != nil || dec.More() {
+			row.err = apperror.Validation("invalid_line", "line is not a JSON object")
+		}
+
+		return row, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+func productReqOf(p *entity.Product) entity.ProductReq {
+	return entity.ProductReq{
+		Name:             p.Name,
+		Image:            p.Image,
+		CategoryID:       p.CategoryID,
+		Description:      p.Description,
+		Price:            p.Price,
+		CountInStock:     p.CountInStock,
+		ReorderThreshold: p.ReorderThreshold,
+	}
+}
+
+// applyImportRow overlays the fields of the row onto the product and validates
+// the result. Only new products take their stock from the row, an existing
+// one keeps its stock.
+func applyImportRow(p *entity.Product, row *importRow, existing bool) error {
+	current, err := json.Marshal(productReqOf(p))
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
+	}
+	for k, v := range row.fields {
+		doc[k] = v
+	}
+
+	merged, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	var req entity.ProductReq
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return apperror.Validation("invalid_line", "line is invalid",
+				apperror.FieldError{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()})
+		}
+		return apperror.Validation("invalid_line", err.Error())
+	}
+	if err := validation.Struct(req); err != nil {
+		return err
+	}
+	p.Name = req.Name
+	p.Image = req.Image
+	p.CategoryID = req.CategoryID
+	p.Description = req.Description
+	p.Price = req.Price
+	p.ReorderThreshold = req.ReorderThreshold
+	if !existing {
+		p.CountInStock = req.CountInStock
+	}
+
+	return nil
+}
+
+// ImportProducts upserts products read from r, matching existing products by
+// name. Lines are validated one by one, a bad line is reported and skipped. In
+// a dry run nothing is written but the report shows what would happen.
+// progress, if given, is called after every batch.
+func (s *ProductService) ImportProducts(ctx context.Context, format entity.ImportFormat, r io.Reader, dryRun bool, progress func(*entity.ImportReport)) (*entity.ImportReport, error) {
+	rows, err := newRowReader(format, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.importRows(ctx, rows, dryRun, progress)
+}
+
+func (s *ProductService) importRows(ctx context.Context, rows rowReader, dryRun bool, progress func(*entity.ImportReport)) (*entity.ImportReport, error) {
+	report := &entity.ImportReport{DryRun: dryRun, Results: []entity.ImportLine{}}
+
+	// a dry run writes nothing, so the products it would have written are
+	// kept by name for the later batches to find
+	var planned map[string]*entity.Product
+	if dryRun {
+		planned = make(map[string]*entity.Product)
+	}
+
+	var batch []*importRow
+	names := make(map[string]bool)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.importBatch(ctx, batch, planned, report); err != nil {
+			return err
+		}
+
+		batch = batch[:0]
+		names = make(map[string]bool)
+		if progress != nil {
+			progress(report)
+		}
+
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("error reading import: %w", err)
+		}
+
+		// a name may only occur once per batch, otherwise a later line could
+		// not see the product created by an earlier one
+		if name, _ := row.fields["name"].(string); name != "" {
+			if names[name] {
+				if err := flush(); err != nil {
+					return report, err
+				}
+			}
+			names[name] = true
+		}
+
+		batch = append(batch, row)
+		if len(batch) >= importBatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// importBatch looks up, applies and writes one batch. planned is only set in a
+// dry run, see importRows.
+func (s *ProductService) importBatch(ctx context.Context, batch []*importRow, planned map[string]*entity.Product, report *entity.ImportReport) error {
+	dryRun := planned != nil
+
+	var names []string
+	for _, row := range batch {
+		if name, ok := row.fields["name"].(string); ok && row.err == nil {
+			names = append(names, name)
+		}
+	}
+
+	existing, err := s.repo.GetProductsByName(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]*entity.Product, len(existing))
+	for i := range existing {
+		// with duplicate names the oldest product wins
+		if _, ok := byName[existing[i].Name]; !ok {
+			byName[existing[i].Name] = &existing[i]
+		}
+	}
+	for _, name := range names {
+		if p, ok := planned[name]; ok {
+			c := *p
+			byName[name] = &c
+		}
+	}
+
+	lines := make([]entity.ImportLine, len(batch))
+	products := make([]*entity.Product, len(batch))
+	var categoryIDs []int64
+	for i, row := range batch {
+		lines[i].Line = row.line
+		if row.err != nil {
+			failImportLine(&lines[i], row.err)
+			continue
+		}
+
+		name, _ := row.fields["name"].(string)
+		p, ok := byName[name]
+		if ok {
+			lines[i].Action = entity.ImportActionUpdate
+		} else {
+			p = &entity.Product{}
+			lines[i].Action = entity.ImportActionCreate
+		}
+
+		if err := applyImportRow(p, row, lines[i].Action == entity.ImportActionUpdate); err != nil {
+			failImportLine(&lines[i], err)
+			continue
+		}
+
+		products[i] = p
+		lines[i].Name = p.Name
+		categoryIDs = append(categoryIDs, p.CategoryID)
+	}
+
+	categories, err := s.categoryNames(ctx, categoryIDs)
+	if err != nil {
+		return err
+	}
+
+	var creates, updates []*entity.Product
+	for i, p := range products {
+		if p == nil {
+			continue
+		}
+
+		name, ok := categories[p.CategoryID]
+		if !ok {
+			failImportLine(&lines[i], unknownCategory(p.CategoryID))
+			products[i] = nil
+			continue
+		}
+		p.Category = name
+
+		if lines[i].Action == entity.ImportActionUpdate {
+			updates = append(updates, p)
+		} else {
+			creates = append(creates, p)
+		}
+	}
+
+	if dryRun {
+		for _, p := range append(creates, updates...) {
+			planned[p.Name] = p
+		}
+	} else {
+		missed, err := s.repo.UpsertProducts(ctx, creates, updates)
+		if err != nil {
+			return err
+		}
+
+		s.checker.Trigger()
+
+		conflicts := make(map[int64]bool, len(missed))
+		for _, id := range missed {
+			conflicts[id] = true
+		}
+		for i, p := range products {
+			if p != nil && conflicts[p.ID] && lines[i].Action == entity.ImportActionUpdate {
+				failImportLine(&lines[i], apperror.Conflict("version_conflict", fmt.Sprintf("product %d was modified concurrently", p.ID)))
+			}
+		}
+	}
+
+	for i := range lines {
+		if products[i] != nil && lines[i].Action != entity.ImportActionError {
+			lines[i].ID = products[i].ID
+		}
+
+		switch lines[i].Action {
+		case entity.ImportActionCreate:
+			report.Created++
+		case entity.ImportActionUpdate:
+			report.Updated++
+		default:
+			report.Failed++
+		}
+
+		if len(report.Results) < maxImportResults {
+			report.Results = append(report.Results, lines[i])
+		} else {
+			report.Truncated = true
+		}
+	}
+	report.Lines += len(lines)
+
+	return nil
+}
+
+func failImportLine(line *entity.ImportLine, err error) {
+	line.Action = entity.ImportActionError
+
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		line.Message = appErr.Message
+		line.Fields = appErr.Fields
+		return
+	}
+	line.Message = err.Error()
+}
+
+// importTracker keeps the imports running in the background so that their
+// progress can be queried. The imports run until ctx is done and are tracked
+// by running, so that shutdown can wait for them.
+type importTracker struct {
+	ctx     context.Context
+	running *sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*entity.ImportJob
+}
+
+func newImportTracker(ctx context.Context, running *sync.WaitGroup) *importTracker {
+	return &importTracker{ctx: ctx, running: running, jobs: make(map[string]*entity.ImportJob)}
+}
+
+// snapshotImportJob copies the job. Results is only ever appended to, so sharing its
+// backing array up to the current length is safe.
+func snapshotImportJob(job *entity.ImportJob) *entity.ImportJob {
+	c := *job
+	c.Report.Results = job.Report.Results[:len(job.Report.Results):len(job.Report.Results)]
+
+	return &c
+}
+
+func newImportID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// StartProductImport validates the header of the import and then runs it in
+// the background, closing r when done. The import outlives the request that
+// started it, it is only cancelled on shutdown. The returned job can be
+// polled with GetProductImport.
+func (s *ProductService) StartProductImport(format entity.ImportFormat, r io.ReadCloser, dryRun bool) (*entity.ImportJob, error) {
+	rows, err := newRowReader(format, r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	job := &entity.ImportJob{
+		ID:        newImportID(),
+		Status:    entity.ImportStatusRunning,
+		Format:    format,
+		StartedAt: time.Now(),
+		Report:    entity.ImportReport{DryRun: dryRun, Results: []entity.ImportLine{}},
+	}
+
+	t := s.imports
+	t.mu.Lock()
+	for id, j := range t.jobs {
+		if j.FinishedAt != nil && time.Since(*j.FinishedAt) > importJobTTL {
+			delete(t.jobs, id)
+		}
+	}
+	t.jobs[job.ID] = job
+	started := snapshotImportJob(job)
+	t.mu.Unlock()
+
+	t.running.Add(1)
+	go func() {
+		defer t.running.Done()
+		defer r.Close()
+
+		report, err := s.importRows(t.ctx, rows, dryRun, func(report *entity.ImportReport) {
+			t.mu.Lock()
+			job.Report = *report
+			t.mu.Unlock()
+		})
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Report = *report
+		job.Status = entity.ImportStatusDone
+		if err != nil {
+			slog.ErrorContext(t.ctx, "error importing products", "import_id", job.ID, "error", err)
+			job.Status = entity.ImportStatusFailed
+			job.Error = "import aborted after " + strconv.Itoa(report.Lines) + " lines"
+			if t.ctx.Err() != nil {
+				job.Error += ", the server is shutting down"
+			}
+		}
+	}()
+
+	return started, nil
+}
+
+func (s *ProductService) GetProductImport(id string) (*entity.ImportJob, error) {
+	t := s.imports
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job, ok := t.jobs[id]
+	if !ok {
+		return nil, apperror.NotFound("import_not_found", "import not found")
+	}
+
+	return snapshotImportJob(job), nil
+}
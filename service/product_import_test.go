@@ -0,0 +1,307 @@
+package service
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func withTestService(t *testing.T, fn func(*ProductService, sqlmock.Sqlmock)) {
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	s := NewProductService(context.Background(), new(sync.WaitGroup),
+		repository.NewProductRepository(db), repository.NewCategoryRepository(db), nil, nil)
+
+	fn(s, mock)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectImportBatch expects the lookups of one import batch by names and
+// categoryIDs, returning the given existing products and category 1.
+func expectImportBatch(mock sqlmock.Sqlmock, names []string, categoryIDs []int64, existing ...entity.Product) {
+	products := sqlmock.NewRows([]string{"id", "version", "name", "category", "category_id", "price", "count_in_stock"})
+	for _, p := range existing {
+		products.AddRow(p.ID, p.Version, p.Name, p.Category, p.CategoryID, p.Price, p.CountInStock)
+	}
+	mock.ExpectQuery("SELECT * FROM product WHERE name = ANY($1) AND deleted_at IS NULL ORDER BY id").
+		WithArgs(pq.Array(names)).
+		WillReturnRows(products)
+	mock.ExpectQuery("SELECT * FROM category WHERE id = ANY($1) ORDER BY id").
+		WithArgs(pq.Array(categoryIDs)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "path"}).AddRow(1, "tools", "tools", "1"))
+}
+
+func fieldErrors(err error) []apperror.FieldError {
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		return appErr.Fields
+	}
+	return nil
+}
+
+func TestCSVRowReaderHeader(t *testing.T) {
+	tcs := []struct {
+		name   string
+		header string
+		fields []apperror.FieldError
+		err    string
+	}{
+		{
+			name:   "importable columns",
+			header: "name,category_id,price,count_in_stock",
+		},
+		{
+			name:   "byte order mark and spaces",
+			header: "\ufeffname , price",
+		},
+		{
+			name:   "empty import",
+			header: "",
+			err:    "import is empty",
+		},
+		{
+			name:   "unknown column",
+			header: "name,colour",
+			err:    "invalid CSV header",
+			fields: []apperror.FieldError{{Field: "colour", Message: "unknown column"}},
+		},
+		{
+			name:   "generated column",
+			header: "id,name,rating",
+			err:    "invalid CSV header",
+			fields: []apperror.FieldError{{Field: "id", Message: "unknown column"}, {Field: "rating", Message: "unknown column"}},
+		},
+		{
+			name:   "duplicate column",
+			header: "name,price,price",
+			err:    "invalid CSV header",
+			fields: []apperror.FieldError{{Field: "price", Message: "duplicate column"}},
+		},
+		{
+			name:   "missing name",
+			header: "price",
+			err:    "invalid CSV header",
+			fields: []apperror.FieldError{{Field: "name", Message: "is required"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newCSVRowReader(strings.NewReader(tc.header))
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, apperror.ErrValidation)
+			require.EqualError(t, err, tc.err)
+			require.Equal(t, tc.fields, fieldErrors(err))
+		})
+	}
+}
+
+func TestCSVRowReaderNext(t *testing.T) {
+	const input = "name,price,count_in_stock,description\n" +
+		"hammer,9.5, 3 ,heavy\n" +
+		"saw,,,\n" +
+		"drill,cheap,1.5,\n" +
+		"\"broken,1,1,\n"
+
+	rows, err := newCSVRowReader(strings.NewReader(input))
+	require.NoError(t, err)
+
+	row, err := rows.Next()
+	require.NoError(t, err)
+	require.NoError(t, row.err)
+	require.Equal(t, 2, row.line)
+	require.Equal(t, map[string]interface{}{"name": "hammer", "price": 9.5, "count_in_stock": int64(3), "description": "heavy"}, row.fields)
+
+	// empty cells leave the column out
+	row, err = rows.Next()
+	require.NoError(t, err)
+	require.NoError(t, row.err)
+	require.Equal(t, 3, row.line)
+	require.Equal(t, map[string]interface{}{"name": "saw"}, row.fields)
+
+	row, err = rows.Next()
+	require.NoError(t, err)
+	require.Equal(t, 4, row.line)
+	require.ErrorIs(t, row.err, apperror.ErrValidation)
+	require.Equal(t, []apperror.FieldError{
+		{Field: "price", Message: "must be a number"},
+		{Field: "count_in_stock", Message: "must be an integer"},
+	}, fieldErrors(row.err))
+
+	row, err = rows.Next()
+	require.NoError(t, err)
+	require.Equal(t, 5, row.line)
+	require.ErrorIs(t, row.err, apperror.ErrValidation)
+
+	_, err = rows.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestNDJSONRowReaderNext(t *testing.T) {
+	const input = `{"name": "hammer", "price": 9.5}` + "\n" +
+		"\n" +
+		"   \n" +
+		`{"name": "saw"` + "\n" +
+		`{"name": "drill"} {"name": "file"}` + "\n" +
+		`["name"]` + "\n" +
+		`{"name": "plane", "colour": "red"}`
+
+	rows := newNDJSONRowReader(strings.NewReader(input))
+
+	tcs := []struct {
+		line   int
+		fields map[string]interface{}
+		err    bool
+	}{
+		{line: 1, fields: map[string]interface{}{"name": "hammer", "price": "9.5"}},
+		// blank lines are skipped but counted
+		{line: 4, err: true},
+		{line: 5, err: true},
+		{line: 6, err: true},
+		// unknown keys are only reported when the row is applied
+		{line: 7, fields: map[string]interface{}{"name": "plane", "colour": "red"}},
+	}
+
+	for _, tc := range tcs {
+		row, err := rows.Next()
+		require.NoError(t, err)
+		require.Equal(t, tc.line, row.line)
+		if tc.err {
+			require.ErrorIs(t, row.err, apperror.ErrValidation)
+			require.EqualError(t, row.err, "line is not a JSON object")
+			continue
+		}
+
+		require.NoError(t, row.err)
+		fields := make(map[string]interface{}, len(row.fields))
+		for k, v := range row.fields {
+			fields[k] = fmt.Sprint(v)
+		}
+		require.Equal(t, tc.fields, fields)
+	}
+
+	_, err := rows.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestImportProductsDryRun(t *testing.T) {
+	existing := entity.Product{ID: 7, Version: 2, Name: "saw", Category: "tools", CategoryID: 1, Price: 12, CountInStock: 4}
+
+	const input = `{"name": "hammer", "category_id": 1, "price": 9.5, "count_in_stock": 3}` + "\n" +
+		`{"name": "saw", "price": 15}` + "\n" +
+		`not json` + "\n" +
+		`{"name": "drill", "category_id": 9}` + "\n" +
+		`{"name": "file", "colour": "red"}` + "\n" +
+		`{"name": "saw", "count_in_stock": 10}` + "\n" +
+		`{"name": "hammer", "price": 11}` + "\n"
+
+	withTestService(t, func(s *ProductService, mock sqlmock.Sqlmock) {
+		// the repeated name starts a second batch, which still finds hammer as
+		// created by the first one although nothing was written
+		expectImportBatch(mock, []string{"hammer", "saw", "drill", "file"}, []int64{1, 1, 9}, existing)
+		expectImportBatch(mock, []string{"saw", "hammer"}, []int64{1, 1}, existing)
+
+		var batches int
+		report, err := s.ImportProducts(context.Background(), entity.ImportFormatNDJSON, strings.NewReader(input), true, func(*entity.ImportReport) {
+			batches++
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, batches)
+
+		require.True(t, report.DryRun)
+		require.Equal(t, 7, report.Lines)
+		require.Equal(t, 1, report.Created)
+		require.Equal(t, 3, report.Updated)
+		require.Equal(t, 3, report.Failed)
+		require.False(t, report.Truncated)
+
+		actions := make([]entity.ImportAction, len(report.Results))
+		for i, line := range report.Results {
+			require.Equal(t, i+1, line.Line)
+			actions[i] = line.Action
+		}
+		require.Equal(t, []entity.ImportAction{
+			entity.ImportActionCreate,
+			entity.ImportActionUpdate,
+			entity.ImportActionError,
+			entity.ImportActionError,
+			entity.ImportActionError,
+			entity.ImportActionUpdate,
+			entity.ImportActionUpdate,
+		}, actions)
+
+		require.Equal(t, int64(7), report.Results[1].ID)
+		require.Equal(t, "category 9 not found", report.Results[3].Message)
+		// the stock of an existing product is left alone
+		require.Equal(t, int64(7), report.Results[5].ID)
+	})
+}
+
+func TestImportProductsTruncatesResults(t *testing.T) {
+	lines := maxImportResults + 1
+
+	var input strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&input, "{\"name\": \"product %d\", \"category_id\": 1}\n", i)
+	}
+
+	withTestService(t, func(s *ProductService, mock sqlmock.Sqlmock) {
+		for start := 0; start < lines; start += importBatchSize {
+			var names []string
+			var categoryIDs []int64
+			for i := start; i < lines && i < start+importBatchSize; i++ {
+				names = append(names, fmt.Sprintf("product %d", i))
+				categoryIDs = append(categoryIDs, 1)
+			}
+			expectImportBatch(mock, names, categoryIDs)
+		}
+
+		report, err := s.ImportProducts(context.Background(), entity.ImportFormatNDJSON, strings.NewReader(input.String()), true, nil)
+		require.NoError(t, err)
+		require.Equal(t, lines, report.Lines)
+		require.Equal(t, lines, report.Created)
+		require.Len(t, report.Results, maxImportResults)
+		require.True(t, report.Truncated)
+	})
+}
+
+func TestStartProductImportStopsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var jobs sync.WaitGroup
+	s := NewProductService(ctx, &jobs, nil, nil, nil, nil)
+
+	job, err := s.StartProductImport(entity.ImportFormatNDJSON, io.NopCloser(strings.NewReader(`{"name": "hammer"}`)), false)
+	require.NoError(t, err)
+	require.Equal(t, entity.ImportStatusRunning, job.Status)
+
+	jobs.Wait()
+
+	job, err = s.GetProductImport(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, entity.ImportStatusFailed, job.Status)
+	require.Equal(t, "import aborted after 0 lines, the server is shutting down", job.Error)
+	require.NotNil(t, job.FinishedAt)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"context"
+	"log/slog"
+	"time"
+)
+
+type PriceService struct {
+	repo     *repository.ProductPriceRepository
+	products *repository.ProductRepository
+}
+
+func NewPriceService(repo *repository.ProductPriceRepository, products *repository.ProductRepository) *PriceService {
+	return &PriceService{
+		repo:     repo,
+		products: products,
+	}
+}
+
+// SchedulePrice changes the price of the product at the given time, right away
+// when at is nil. Past prices are history and cannot be changed.
+func (s *PriceService) SchedulePrice(ctx context.Context, productID int64, price float64, at *time.Time) (*entity.ProductPrice, error) {
+	if at != nil && at.Before(time.Now()) {
+		return nil, apperror.Validation("invalid_effective_from", "effective_from is in the past",
+			apperror.FieldError{Field: "effective_from", Message: "must not be in the past"})
+	}
+
+	return s.repo.SchedulePrice(ctx, productID, price, at)
+}
+
+// ListPrices returns the price history of the product. Unlike an empty list, a
+// missing product is reported as not found.
+func (s *PriceService) ListPrices(ctx context.Context, productID int64, at *time.Time) ([]entity.ProductPrice, error) {
+	if _, err := s.products.GetProduct(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListPrices(ctx, productID, at)
+}
+
+func (s *PriceService) DeletePrice(ctx context.Context, productID, id int64) error {
+	return s.repo.DeletePrice(ctx, productID, id)
+}
+
+// RunScheduler applies scheduled price changes to the products every interval
+// until ctx is done.
+func (s *PriceService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.repo.ApplyScheduledPrices(ctx); err != nil {
+			slog.ErrorContext(ctx, "error applying scheduled prices", "error", err)
+		}
+	}
+}
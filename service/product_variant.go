@@ -0,0 +1,32 @@
+package service
+
+import (
+	"chi-sqlx/database/entity"
+	"context"
+)
+
+func (s *ProductService) CreateVariant(ctx context.Context, v *entity.ProductVariant) (*entity.ProductVariant, error) {
+	return s.variants.CreateVariant(ctx, v)
+}
+
+func (s *ProductService) GetVariant(ctx context.Context, productID, id int64) (*entity.ProductVariant, error) {
+	return s.variants.GetVariant(ctx, productID, id)
+}
+
+// ListVariants returns the variants of the product. Unlike an empty list, a
+// missing product is reported as not found.
+func (s *ProductService) ListVariants(ctx context.Context, productID int64) ([]entity.ProductVariant, error) {
+	if _, err := s.repo.GetProduct(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	return s.variants.ListVariants(ctx, productID)
+}
+
+func (s *ProductService) UpdateVariant(ctx context.Context, v *entity.ProductVariant) (*entity.ProductVariant, error) {
+	return s.variants.UpdateVariant(ctx, v)
+}
+
+func (s *ProductService) DeleteVariant(ctx context.Context, productID, id int64) error {
+	return s.variants.DeleteVariant(ctx, productID, id)
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"context"
+)
+
+type ReviewService struct {
+	repo     *repository.ReviewRepository
+	products *repository.ProductRepository
+}
+
+func NewReviewService(repo *repository.ReviewRepository, products *repository.ProductRepository) *ReviewService {
+	return &ReviewService{
+		repo:     repo,
+		products: products,
+	}
+}
+
+func (s *ReviewService) CreateReview(ctx context.Context, r *entity.Review) (*entity.Review, error) {
+	return s.repo.CreateReview(ctx, r)
+}
+
+func (s *ReviewService) GetReview(ctx context.Context, productID, id int64) (*entity.Review, error) {
+	return s.repo.GetReview(ctx, productID, id)
+}
+
+// ListReviews returns one page of the reviews of the product. Unlike an empty
+// page, a missing product is reported as not found.
+func (s *ReviewService) ListReviews(ctx context.Context, productID int64, filter entity.ReviewFilter, page entity.Pagination) (*entity.Page[entity.Review], error) {
+	if _, err := s.products.GetProduct(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListReviews(ctx, productID, filter, page)
+}
+
+func (s *ReviewService) UpdateReview(ctx context.Context, r *entity.Review) (*entity.Review, error) {
+	return s.repo.UpdateReview(ctx, r)
+}
+
+func (s *ReviewService) ModerateReview(ctx context.Context, productID, id int64, status entity.ReviewStatus) (*entity.Review, error) {
+	return s.repo.ModerateReview(ctx, productID, id, status)
+}
+
+func (s *ReviewService) DeleteReview(ctx context.Context, productID, id int64) error {
+	return s.repo.DeleteReview(ctx, productID, id)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"chi-sqlx/database/entity"
+	"chi-sqlx/database/repository"
+	"context"
+	"time"
+)
+
+type StockService struct {
+	repo     *repository.StockRepository
+	products *repository.ProductRepository
+	variants *repository.ProductVariantRepository
+	checker  *StockChecker
+}
+
+func NewStockService(repo *repository.StockRepository, products *repository.ProductRepository, variants *repository.ProductVariantRepository, checker *StockChecker) *StockService {
+	return &StockService{
+		repo:     repo,
+		products: products,
+		variants: variants,
+		checker:  checker,
+	}
+}
+
+// ChangeStock records the movement and returns the new count in stock.
+func (s *StockService) ChangeStock(ctx context.Context, m *entity.StockMovement) (int64, error) {
+	count, err := s.repo.ChangeStock(ctx, m)
+	if err != nil {
+		return 0, err
+	}
+
+	s.checker.Trigger()
+	return count, nil
+}
+
+// StockAt returns the stock of the product, or of one of its variants, at the
+// given time. Unlike a stock of zero, a missing product or variant is reported
+// as not found.
+func (s *StockService) StockAt(ctx context.Context, productID int64, variantID *int64, at time.Time) (int64, error) {
+	if err := s.checkExists(ctx, productID, variantID); err != nil {
+		return 0, err
+	}
+
+	return s.repo.StockAt(ctx, productID, variantID, at)
+}
+
+// ListStockMovements returns one page of the stock ledger of the product.
+// Unlike an empty page, a missing product or variant is reported as not found.
+func (s *StockService) ListStockMovements(ctx context.Context, productID int64, variantID *int64, page entity.Pagination) (*entity.Page[entity.StockMovement], error) {
+	if err := s.checkExists(ctx, productID, variantID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListStockMovements(ctx, productID, variantID, page)
+}
+
+func (s *StockService) checkExists(ctx context.Context, productID int64, variantID *int64) error {
+	if variantID != nil {
+		_, err := s.variants.GetVariant(ctx, productID, *variantID)
+		return err
+	}
+
+	_, err := s.products.GetProduct(ctx, productID)
+	return err
+}
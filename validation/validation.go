@@ -0,0 +1,225 @@
+// Package validation checks request structs against the rules declared in
+// their `validate` struct tags, e.g.
+//
+//	Name  string  `json:"name" validate:"required,max=255"`
+//	Price float64 `json:"price" validate:"min=0"`
+//
+// Supported rules are required, min=N, max=N, oneof=a b c and slug. For strings
+// and slices min and max bound the length, for numbers the value. slug accepts
+// lowercase letters and digits separated by single hyphens, or nothing. Rules
+// on pointer fields apply to the value pointed to, nil only fails required. Nested structs
+// and slices of structs are validated recursively. Violations are reported per
+// field using the JSON names, e.g. "items[1].quantity".
+package validation
+
+import (
+	"chi-sqlx/apperror"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Struct validates v, which must be a struct or a pointer to one. It returns
+// nil or an apperror.ErrValidation error listing every violated field.
+func Struct(v interface{}) error {
+	var fields []apperror.FieldError
+	validateStruct(reflect.Indirect(reflect.ValueOf(v)), "", &fields)
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return apperror.Validation("validation_failed", "request body is invalid", fields...)
+}
+
+func validateStruct(v reflect.Value, prefix string, fields *[]apperror.FieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := fieldName(sf)
+		if name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			if msg := check(fv, tag); msg != "" {
+				*fields = append(*fields, apperror.FieldError{Field: name, Message: msg})
+				continue
+			}
+		}
+
+		switch fv.Kind() {
+		case reflect.Struct:
+			validateStruct(fv, name, fields)
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() != reflect.Struct {
+				continue
+			}
+			for j := 0; j < fv.Len(); j++ {
+				validateStruct(fv.Index(j), fmt.Sprintf("%s[%d]", name, j), fields)
+			}
+		}
+	}
+}
+
+// fieldName returns the JSON name of the field, falling back to the Go name.
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+
+	return name
+}
+
+// check applies the comma separated rules to the value and describes the first
+// violation, or returns an empty string.
+func check(v reflect.Value, tag string) string {
+	rules := strings.Split(tag, ",")
+
+	// a nil pointer only violates required, otherwise the rules apply to the
+	// value pointed to
+	if v.Kind() == reflect.Pointer {
+		if !v.IsNil() {
+			return check(v.Elem(), tag)
+		}
+		for _, rule := range rules {
+			if rule == "required" {
+				return "is required"
+			}
+		}
+		return ""
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		var msg string
+		switch name {
+		case "required":
+			msg = checkRequired(v)
+		case "min":
+			msg = checkBound(v, arg, true)
+		case "max":
+			msg = checkBound(v, arg, false)
+		case "oneof":
+			msg = checkOneOf(v, arg)
+		case "slug":
+			msg = checkSlug(v)
+		default:
+			panic("validation: unknown rule " + rule)
+		}
+
+		if msg != "" {
+			return msg
+		}
+	}
+
+	return ""
+}
+
+func checkRequired(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		if strings.TrimSpace(v.String()) == "" {
+			return "is required"
+		}
+	case reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			return "is required"
+		}
+	default:
+		if v.IsZero() {
+			return "is required"
+		}
+	}
+
+	return ""
+}
+
+func checkBound(v reflect.Value, arg string, min bool) string {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic("validation: invalid bound " + arg)
+	}
+
+	var n float64
+	var unit string
+	switch v.Kind() {
+	case reflect.String:
+		n = float64(utf8.RuneCountInString(v.String()))
+		unit = " characters"
+	case reflect.Slice, reflect.Map:
+		n = float64(v.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		panic("validation: min and max do not apply to " + v.Kind().String())
+	}
+
+	switch {
+	case min && n < bound:
+		if unit != "" {
+			return "must have at least " + arg + unit
+		}
+		return "must be at least " + arg
+	case !min && n > bound:
+		if unit != "" {
+			return "must have at most " + arg + unit
+		}
+		return "must be at most " + arg
+	}
+
+	return ""
+}
+
+func checkOneOf(v reflect.Value, arg string) string {
+	if v.Kind() != reflect.String {
+		panic("validation: oneof only applies to strings")
+	}
+
+	options := strings.Fields(arg)
+	for _, option := range options {
+		if v.String() == option {
+			return ""
+		}
+	}
+
+	return "must be one of " + strings.Join(options, ", ")
+}
+
+func checkSlug(v reflect.Value) string {
+	if v.Kind() != reflect.String {
+		panic("validation: slug only applies to strings")
+	}
+
+	s := v.String()
+	if s == "" {
+		return ""
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-' && i > 0 && i < len(s)-1 && s[i-1] != '-':
+		default:
+			return "must be lowercase letters and digits separated by hyphens"
+		}
+	}
+
+	return ""
+}
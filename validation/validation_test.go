@@ -0,0 +1,148 @@
+package validation
+
+import (
+	"chi-sqlx/apperror"
+	"chi-sqlx/database/entity"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStruct(t *testing.T) {
+	negative := -1.0
+
+	tcs := []struct {
+		name   string
+		input  interface{}
+		fields []apperror.FieldError
+	}{
+		{
+			name: "valid product",
+			input: entity.ProductReq{
+				Name:         "test product",
+				CategoryID:   1,
+				Price:        10.5,
+				CountInStock: 0,
+			},
+		},
+		{
+			name: "invalid product",
+			input: &entity.ProductReq{
+				Name:             " ",
+				CategoryID:       1,
+				Price:            -1,
+				CountInStock:     -1,
+				ReorderThreshold: -1,
+			},
+			fields: []apperror.FieldError{
+				{Field: "name", Message: "is required"},
+				{Field: "price", Message: "must be at least 0"},
+				{Field: "count_in_stock", Message: "must be at least 0"},
+				{Field: "reorder_threshold", Message: "must be at least 0"},
+			},
+		},
+		{
+			name:  "order without items",
+			input: entity.OrderReq{PaymentMethod: "card"},
+			fields: []apperror.FieldError{
+				{Field: "items", Message: "is required"},
+			},
+		},
+		{
+			name: "invalid order items",
+			input: entity.OrderReq{
+				PaymentMethod: "card",
+				Items: []entity.OrderItemReq{
+					{Quantity: 1, ProductID: 1},
+					{Quantity: 0},
+				},
+			},
+			fields: []apperror.FieldError{
+				{Field: "items[1].quantity", Message: "must be at least 1"},
+				{Field: "items[1].product_id", Message: "is required"},
+			},
+		},
+		{
+			name:  "valid category",
+			input: entity.CategoryReq{Name: "Audio", Slug: "home-audio-2"},
+		},
+		{
+			name:  "invalid category slug",
+			input: entity.CategoryReq{Name: "Audio", Slug: "Home--Audio"},
+			fields: []apperror.FieldError{
+				{Field: "slug", Message: "must be lowercase letters and digits separated by hyphens"},
+			},
+		},
+		{
+			name:  "valid review",
+			input: entity.ReviewReq{Author: "jane", Stars: 4, Title: "Solid"},
+		},
+		{
+			name:  "review without stars",
+			input: entity.ReviewReq{Author: "jane"},
+			fields: []apperror.FieldError{
+				{Field: "stars", Message: "must be at least 1"},
+			},
+		},
+		{
+			name:  "review moderation status",
+			input: entity.ReviewModerationReq{Status: "hidden"},
+			fields: []apperror.FieldError{
+				{Field: "status", Message: "must be one of published, rejected"},
+			},
+		},
+		{
+			name:  "variant without price",
+			input: entity.ProductVariantReq{SKU: "TS-M-RED"},
+		},
+		{
+			name:  "variant with negative price",
+			input: entity.ProductVariantReq{SKU: "TS-M-RED", Price: &negative},
+			fields: []apperror.FieldError{
+				{Field: "price", Message: "must be at least 0"},
+			},
+		},
+		{
+			name:  "valid stock change",
+			input: entity.StockChangeReq{Delta: -2, Reason: entity.StockReasonAdjustment},
+		},
+		{
+			name:  "stock change without delta",
+			input: entity.StockChangeReq{Reason: entity.StockReasonSale},
+			fields: []apperror.FieldError{
+				{Field: "delta", Message: "is required"},
+				{Field: "reason", Message: "must be one of restock, adjustment, return"},
+			},
+		},
+		{
+			name:  "negative scheduled price",
+			input: entity.ProductPriceReq{Price: -5},
+			fields: []apperror.FieldError{
+				{Field: "price", Message: "must be at least 0"},
+			},
+		},
+		{
+			name:  "unknown order status",
+			input: entity.OrderTransitionReq{Status: "lost"},
+			fields: []apperror.FieldError{
+				{Field: "status", Message: "must be one of pending, paid, shipped, delivered, cancelled"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Struct(tc.input)
+			if tc.fields == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, apperror.ErrValidation)
+			var appErr *apperror.Error
+			require.True(t, errors.As(err, &appErr))
+			require.Equal(t, tc.fields, appErr.Fields)
+		})
+	}
+}